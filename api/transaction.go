@@ -16,6 +16,12 @@ type (
 	TransactionalKvStorage interface {
 		Transaction() (KvStorageTransaction, error)
 	}
+	// IterableKvStorage is a storage whose keys can be enumerated,
+	// Keys returns at most limit keys greater than or equal to start in ascending order.
+	IterableKvStorage interface {
+		TransactionalKvStorage
+		Keys(start []byte, limit int) ([][]byte, error)
+	}
 )
 
 var NotFound = errors.New("key not found")
@@ -1,61 +1,163 @@
 package mpt
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+
 	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
 	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
 )
 
 type Batch struct {
-	root    internal.Node
-	toDel   [][]byte
-	kv      api.KvStorageTransaction
-	rootKey []byte
-	hFac    HasherFactory
+	root internal.Node
+	// root hash of the trie when the batch was created
+	rootHash []byte
+	kv       api.KvStorageTransaction
+	rootKey  []byte
+	format
+	archive  bool
+	readOnly bool
+	guard    *pruneGuard
+	nodes    *nodeCache
+	// number of goroutines serializing the nodes on commit
+	commitWorkers int
+	// set once the batch is committed or aborted
+	closed bool
+	// lets the next batch of the trie start, nil for a reading batch
+	release func()
+	// approximate memory held by the nodes, spilled beyond memoryLimit
+	memory      int
+	memoryLimit int
+	// hashes of the nodes written by spill, not counted yet
+	spilled map[string]struct{}
 }
 
 func (t *Batch) Abort() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	defer t.unlock()
 	return t.kv.Abort()
 }
 
-// the batch should not be used after committed
+func (t *Batch) unlock() {
+	if t.release != nil {
+		t.release()
+		t.release = nil
+	}
+}
+
+// the batch cannot be used after committed, its methods return BatchClosed
 func (t *Batch) Commit() error {
-	if t.root == nil {
-		err := t.Delete(t.rootKey)
+	return t.CommitWithMetadata(nil)
+}
+
+// CommitWithMetadata commits the batch like Commit,
+// and records metadata along with the new root in the root history.
+func (t *Batch) CommitWithMetadata(metadata []byte) error {
+	if t.closed {
+		return BatchClosed
+	}
+	if t.readOnly {
+		return ReadOnly
+	}
+	err := t.commit(metadata)
+	if err != nil {
+		t.Abort()
+		return err
+	}
+	t.closed = true
+	defer t.unlock()
+	return t.kv.Commit()
+}
+
+// commit writes the new nodes, the root and the history record to the transaction
+func (t *Batch) commit(metadata []byte) error {
+	store := newNodeStore(t.kv, t.hasher())
+	store.guard = t.guard
+	var newRoot []byte
+	if t.root != nil {
+		// the dirty subtrees are serialized concurrently,
+		// then the nodes are stored in the order of the trie
+		enc := newEncoder(t.hasher, t.commitWorkers)
+		if err := enc.encode(t.root, store.hasher); err != nil {
+			return err
+		}
+		store.encoded = enc.encoded
+		// reference the new nodes before releasing the old root,
+		// so the nodes shared by both roots are kept
+		h, err := store.ref(t.root)
 		if err != nil {
 			return err
 		}
-		return nil
+		newRoot = h
+	}
+	if err := t.dropSpilled(store); err != nil {
+		return err
+	}
+	return t.publish(store, newRoot, metadata)
+}
+
+// publish points the trie to newRoot, which is referenced in store,
+// and records it in the root history
+func (t *Batch) publish(store *nodeStore, newRoot, metadata []byte) error {
+	err := store.replaceRoot(t.rootKey, t.rootHash, newRoot, t.archive)
+	if err != nil {
+		return err
 	}
-	for _, key := range t.toDel {
-		t.Delete(key)
+	err = recordFormat(t.kv, t.rootKey, t.format)
+	if err != nil {
+		return err
 	}
-	t.commit(t.root)
-	h := t.root.CachedHash()
-	hn := internal.HashNode(h)
-	err := t.kv.Put(t.rootKey, hn)
+	err = appendHistory(t.kv, t.rootKey, &pb.PersistRootRecord{
+		Root:     newRoot,
+		Metadata: metadata,
+	})
 	if err != nil {
 		return err
 	}
-	return t.kv.Commit()
-
+	return store.flush()
 }
 
-func (t *Batch) commit(node internal.Node) {
-	switch n := node.(type) {
-	case *internal.FullNode:
-		for i := 0; i < len(n.Children); i++ {
-			if n.Children[i] == nil {
-				continue
-			}
-			t.commit(n.Children[i])
+// resolve loads the node at path referred by a hash node
+func (t *Batch) resolve(n *internal.HashNode, path []byte) (internal.Node, error) {
+	node := t.nodes.get(*n)
+	if node == nil {
+		var err error
+		node, err = loadNode(t.kv, t.hasher(), []byte(*n), path)
+		if err != nil {
+			return nil, err
 		}
-		n.Save(t.kv, t.hFac())
-	case *internal.ShortNode:
-		t.commit(n.Value)
-		n.Save(t.kv, t.hFac())
-	case *internal.ValueNode:
-		n.Save(t.kv, t.hFac())
+		t.nodes.add(*n, node)
+	}
+	if t.memoryLimit > 0 {
+		t.memory += memorySize(node)
+	}
+	return node, nil
+}
+
+// loadNode loads the node of hash h from kv storage and checks that its content matches the hash,
+// path is the key path of the node reported in errors
+func loadNode(kv api.KvStorageTransaction, hasher *internal.Hasher, h, path []byte) (internal.Node, error) {
+	data, err := kv.Get(h)
+	if errors.Is(err, api.NotFound) {
+		// the node is referred by a root or a parent so it must be stored
+		err = fmt.Errorf("%w: missing from kv storage", CorruptedNode)
+	}
+	if err != nil {
+		return nil, &NodeError{Op: "load", Hash: h, Path: path, Err: err}
+	}
+	node, err := internal.DeserializeNode(hasher, data)
+	if err != nil {
+		return nil, &NodeError{Op: "load", Hash: h, Path: path, Err: fmt.Errorf("%w: %w", CorruptedNode, err)}
+	}
+	if !bytes.Equal(h, node.CachedHash()) {
+		return nil, &NodeError{Op: "load", Hash: h, Path: path, Err: HashMismatch}
 	}
+	return node, nil
 }
 
 func commonPrefix(a, b []byte) int {
@@ -3,18 +3,28 @@ package mpt
 import (
 	"bytes"
 	"errors"
-	"fmt"
 
 	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
 )
 
 func (b *Batch) Delete(key []byte) error {
-	n, err := b.delete(b.root, key, 0)
+	if b.closed {
+		return BatchClosed
+	}
+	if b.readOnly {
+		return ReadOnly
+	}
+	n, err := b.delete(b.root, b.path(key), 0)
+	if errors.Is(err, KeyNotFound) {
+		if err := b.fit(); err != nil {
+			return err
+		}
+	}
 	if err != nil {
 		return err
 	}
 	b.root = n
-	return nil
+	return b.fit()
 }
 
 func (b *Batch) delete(node internal.Node, key []byte, prefixLen int) (internal.Node, error) {
@@ -40,22 +50,19 @@ func (b *Batch) delete(node internal.Node, key []byte, prefixLen int) (internal.
 			n.Children[key[prefixLen]] = newNode
 		}
 
-		// only one child remains in this full node
-		// promote it and delete the current one
-		if hasOneChild, child := n.OnlyChild(); hasOneChild {
-			b.toDel = appendEx(b.toDel, n.OriginalKey)
+		n.Status = internal.DIRTY
 
-			// if the child is short node, replace the current node with it
-			if sn, ok := child.(*internal.ShortNode); ok {
-				return sn, nil
+		// only one child remains in this full node
+		// promote it and drop the current one
+		if hasOneChild, index, child := n.OnlyChild(); hasOneChild {
+			// the remaining child is the value of the current prefix
+			if index == 256 {
+				return child, nil
 			}
 
-			// otherwise replace current node with a new short node
-			return &internal.ShortNode{
-				Key:    key[prefixLen:],
-				Value:  child,
-				Status: internal.DIRTY,
-			}, nil
+			// otherwise replace current node with a short node
+			// merging the child if it is a short node itself
+			return b.mergeShortNode(key[:prefixLen], []byte{byte(index)}, child)
 		}
 		return n, nil
 	case *internal.ShortNode:
@@ -70,45 +77,58 @@ func (b *Batch) delete(node internal.Node, key []byte, prefixLen int) (internal.
 		// this short node's value is empty
 		// so the short node itself also needs to be deleted
 		if newNode == nil {
-			b.toDel = appendEx(b.toDel, n.OriginalKey)
 			return nil, nil
 		}
 
 		// the child node turns into a short node
-		// promote the child node, and remove the current one
-		if sn, ok := newNode.(*internal.ShortNode); ok {
-			b.toDel = appendEx(b.toDel, n.OriginalKey)
-			return sn, nil
+		// merge it into the current one
+		if _, ok := newNode.(*internal.ShortNode); ok {
+			return b.mergeShortNode(key[:prefixLen], n.Key, newNode)
 		}
 
 		n.Value = newNode
+		n.Status = internal.DIRTY
 		return node, nil
 	case *internal.HashNode:
-		data, err := b.kv.Get([]byte(*n))
+		loadedNode, err := b.resolve(n, key[:prefixLen])
 		if err != nil {
 			return node, err
 		}
-		loadedNode, err := internal.DeserializeNode(b.hFac(), data)
-		if err != nil {
-			return node, fmt.Errorf("[Trie Batch] Cannot load node: %s", err.Error())
-		}
-		if !bytes.Equal([]byte(*n), loadedNode.Hash(b.hFac())) {
-			return node, fmt.Errorf("[Trie Batch] Cannot load node: hash does not match")
-		}
 		return b.delete(loadedNode, key, prefixLen)
 	case *internal.ValueNode:
 		if prefixLen == len(key) {
-			b.toDel = appendEx(b.toDel, n.OriginalKey)
 			return nil, nil
 		}
 		return nil, KeyNotFound
 	}
-	return node, errors.New("[Tire] Unknown node type")
+	return node, errors.New("[Trie Batch] Unknown node type")
 }
 
-func appendEx(array [][]byte, ele []byte) [][]byte {
-	if ele != nil {
-		return append(array, ele)
+// mergeShortNode creates a short node at path with the given key pointing to child,
+// if child is a short node, its key is appended and its value is taken
+func (b *Batch) mergeShortNode(path, key []byte, child internal.Node) (internal.Node, error) {
+	if hn, ok := child.(*internal.HashNode); ok {
+		loadedNode, err := b.resolve(hn, appendPath(path, key...))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := loadedNode.(*internal.ShortNode); ok {
+			child = loadedNode
+		}
+	}
+	if sn, ok := child.(*internal.ShortNode); ok {
+		newKey := make([]byte, 0, len(key)+len(sn.Key))
+		newKey = append(newKey, key...)
+		newKey = append(newKey, sn.Key...)
+		return &internal.ShortNode{
+			Key:    newKey,
+			Value:  sn.Value,
+			Status: internal.DIRTY,
+		}, nil
 	}
-	return array
+	return &internal.ShortNode{
+		Key:    key,
+		Value:  child,
+		Status: internal.DIRTY,
+	}, nil
 }
@@ -3,16 +3,23 @@ package mpt
 import (
 	"bytes"
 	"errors"
-	"fmt"
 
 	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
 )
 
 func (b *Batch) Get(key []byte) ([]byte, error) {
-	node, expandedNode, err := b.get(b.root, key, 0)
+	if b.closed {
+		return nil, BatchClosed
+	}
+	node, expandedNode, err := b.get(b.root, b.path(key), 0)
 	if expandedNode != nil {
 		b.root = expandedNode
 	}
+	if err == nil || errors.Is(err, KeyNotFound) {
+		if err := b.fit(); err != nil {
+			return nil, err
+		}
+	}
 	if err != nil {
 		return nil, err
 	} else if v, ok := node.(*internal.ValueNode); ok {
@@ -48,17 +55,10 @@ func (b *Batch) get(node internal.Node, key []byte, prefixLen int) (internal.Nod
 		n.Value = newNode
 		return valueNode, node, err
 	case *internal.HashNode:
-		data, err := b.kv.Get([]byte(*n))
+		loadedNode, err := b.resolve(n, key[:prefixLen])
 		if err != nil {
 			return nil, node, err
 		}
-		loadedNode, err := internal.DeserializeNode(b.hFac(), data)
-		if err != nil {
-			return nil, node, fmt.Errorf("[Trie Batch] Cannot load node: %s", err.Error())
-		}
-		if !bytes.Equal([]byte(*n), loadedNode.Hash(b.hFac())) {
-			return nil, node, fmt.Errorf("[Trie Batch] Cannot load node: hash does not match")
-		}
 		valueNode, loadedNode, err := b.get(loadedNode, key, prefixLen)
 		return valueNode, loadedNode, err
 	case *internal.ValueNode:
@@ -68,5 +68,5 @@ func (b *Batch) get(node internal.Node, key []byte, prefixLen int) (internal.Nod
 
 		return nil, node, KeyNotFound
 	}
-	return nil, node, errors.New("[Tire Batch] Unknown node type")
+	return nil, node, errors.New("[Trie Batch] Unknown node type")
 }
@@ -8,22 +8,41 @@ import (
 )
 
 func (b *Batch) Put(key, value []byte) error {
+	if b.closed {
+		return BatchClosed
+	}
+	if b.readOnly {
+		return ReadOnly
+	}
+	if len(value) == 0 && b.emptyDeletes() {
+		err := b.Delete(key)
+		if errors.Is(err, KeyNotFound) {
+			return nil
+		}
+		return err
+	}
 	valueNode := internal.ValueNode{
 		Value:  value,
 		Cache:  nil,
 		Status: internal.DIRTY,
 	}
-	expandedNode, err := b.put(b.root, key, &valueNode, 0)
+	path := b.path(key)
+	expandedNode, err := b.put(b.root, path, &valueNode, 0)
 	if expandedNode != nil {
 		b.root = expandedNode
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	// a put adds at most a full node, two short nodes and the value
+	b.memory += fullNodeSize + 2*(shortNodeSize+len(path)) + valueNodeSize + len(value)
+	return b.fit()
 }
 
 func (b *Batch) put(node internal.Node, key []byte, value internal.Node, prefixLen int) (internal.Node, error) {
 	if node == nil {
 		if prefixLen > len(key) {
-			return node, errors.New("[Trie Batch] Cannot insert")
+			return node, fmt.Errorf("[Trie Batch] Cannot insert %x: %w", key, InvalidKey)
 		} else if prefixLen == len(key) {
 			return value, nil
 		} else {
@@ -39,7 +58,7 @@ func (b *Batch) put(node internal.Node, key []byte, value internal.Node, prefixL
 	case *internal.FullNode:
 		n.Status = internal.DIRTY
 		if prefixLen > len(key) {
-			return node, fmt.Errorf("[Trie Batch] Cannot insert")
+			return node, fmt.Errorf("[Trie Batch] Cannot insert %x: %w", key, InvalidKey)
 		} else if prefixLen == len(key) {
 			n.Children[256] = value
 			return n, nil
@@ -54,7 +73,7 @@ func (b *Batch) put(node internal.Node, key []byte, value internal.Node, prefixL
 	case *internal.ShortNode:
 		n.Status = internal.DIRTY
 		if prefixLen > len(key) {
-			return node, fmt.Errorf("[Trie Batch] Cannot insert")
+			return node, fmt.Errorf("[Trie Batch] Cannot insert %x: %w", key, InvalidKey)
 		}
 		commonLen := commonPrefix(n.Key, key[prefixLen:])
 		if commonLen == len(n.Key) {
@@ -76,10 +95,6 @@ func (b *Batch) put(node internal.Node, key []byte, value internal.Node, prefixL
 			return node, err
 		}
 
-		// current node is unreferred
-		// delete it from kv storage
-		b.toDel = appendEx(b.toDel, n.OriginalKey)
-
 		if commonLen > 0 {
 			shortNode := internal.ShortNode{Status: internal.DIRTY}
 			shortNode.Key = n.Key[:commonLen]
@@ -90,32 +105,26 @@ func (b *Batch) put(node internal.Node, key []byte, value internal.Node, prefixL
 	case *internal.ValueNode:
 		n.Status = internal.DIRTY
 		if prefixLen == len(key) {
-			// current node is unreferred here
-			b.toDel = appendEx(b.toDel, n.OriginalKey)
 			return value, nil
 		} else if prefixLen < len(key) {
 			fullNode := &internal.FullNode{Status: internal.DIRTY}
 			newNode, err := b.put(fullNode, key, value, prefixLen)
 			if err != nil {
-				return node, fmt.Errorf("[Trie Batch] Cannot insert")
+				return node, err
 			}
 			newNode, err = b.put(newNode, key[:prefixLen], node, prefixLen)
 			if err != nil {
-				return node, fmt.Errorf("[Trie Batch] Cannot insert")
+				return node, err
 			}
 			return newNode, nil
 		} else {
-			return node, fmt.Errorf("[Trie Batch] Cannot insert")
+			return node, fmt.Errorf("[Trie Batch] Cannot insert %x: %w", key, InvalidKey)
 		}
 	case *internal.HashNode:
 		if prefixLen > len(key) {
-			return node, fmt.Errorf("[Trie Batch] Cannot insert")
-		}
-		data, err := b.kv.Get([]byte(*n))
-		if err != nil {
-			return node, err
+			return node, fmt.Errorf("[Trie Batch] Cannot insert %x: %w", key, InvalidKey)
 		}
-		newNode, err := internal.DeserializeNode(b.hFac(), data)
+		newNode, err := b.resolve(n, key[:prefixLen])
 		if err != nil {
 			return node, err
 		}
@@ -125,5 +134,5 @@ func (b *Batch) put(node internal.Node, key []byte, value internal.Node, prefixL
 		}
 		return newNode, nil
 	}
-	return node, fmt.Errorf("[Trie Batch] Cannot insert")
+	return node, errors.New("[Trie Batch] Unknown node type")
 }
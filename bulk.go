@@ -0,0 +1,198 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// number of reference counts kept in memory by a BulkBuilder before they are written
+const bulkFlushSize = 1 << 16
+
+// BulkBuilder builds a trie from keys added in strictly ascending order.
+// The subtrees on the left of the last key cannot change anymore,
+// so they are written to the transaction as soon as a greater key is added,
+// only the nodes on the path of the last key are kept in memory.
+// The root hash is the one of a batch putting the same keys.
+type BulkBuilder struct {
+	batch *Batch
+	store *nodeStore
+	root  internal.Node
+	// path of the last added key, nil before the first one
+	last []byte
+}
+
+// BulkBuilder creates a builder on the trie, or on txn if it is not nil.
+// On commit the built trie replaces the current content of the trie, like Import.
+// Like a batch, the builder waits until the previous batch is closed and must always be closed.
+func (t *Trie) BulkBuilder(txn api.KvStorageTransaction) (*BulkBuilder, error) {
+	if t.readOnly {
+		return nil, ReadOnly
+	}
+	batch, err := t.Batch(txn)
+	if err != nil {
+		return nil, err
+	}
+	store := newNodeStore(batch.kv, batch.hasher())
+	store.guard = batch.guard
+	store.encoded = map[internal.Node][]byte{}
+	return &BulkBuilder{batch: batch, store: store}, nil
+}
+
+// Add adds a key greater than every key added before, the key and the value are copied.
+func (b *BulkBuilder) Add(key, value []byte) error {
+	if b.batch.closed {
+		return BatchClosed
+	}
+	path := b.batch.path(key)
+	if b.last != nil && bytes.Compare(path, b.last) <= 0 {
+		return fmt.Errorf("[Trie Bulk] Cannot add %x after a greater or equal key: %w", key, InvalidKey)
+	}
+	path = append([]byte{}, path...)
+	if len(value) == 0 && b.batch.emptyDeletes() {
+		// the key is not added, like a put deleting it
+		b.last = path
+		return nil
+	}
+	valueNode := internal.ValueNode{
+		Value:  append([]byte{}, value...),
+		Status: internal.DIRTY,
+	}
+	root, err := b.batch.put(b.root, path, &valueNode, 0)
+	if err != nil {
+		return err
+	}
+	b.root, b.last = root, path
+	return b.seal(path)
+}
+
+// seal writes the subtrees on the left of path, which were completed by the key of path
+func (b *BulkBuilder) seal(path []byte) error {
+	node, depth := b.root, 0
+	for {
+		switch n := node.(type) {
+		case *internal.ShortNode:
+			node, depth = n.Value, depth+len(n.Key)
+		case *internal.FullNode:
+			if depth == len(path) {
+				return nil
+			}
+			// the children before the last one are sealed already
+			for i := int(path[depth]) - 1; i >= 0; i-- {
+				if n.Children[i] != nil {
+					if err := b.sealChild(n, i); err != nil {
+						return err
+					}
+					break
+				}
+			}
+			node, depth = n.Children[path[depth]], depth+1
+		default:
+			return nil
+		}
+	}
+}
+
+// sealChild writes the child at slot of n and replaces it with its hash.
+// The reference taken on the child is the one of n, it is dropped once n is stored.
+func (b *BulkBuilder) sealChild(n *internal.FullNode, slot int) error {
+	child := n.Children[slot]
+	if _, ok := child.(*internal.HashNode); ok {
+		return nil
+	}
+	// the children encoded in n stay in memory, they are small
+	if b.store.hasher.Codec.InParent(n, slot, child) {
+		return nil
+	}
+	data, err := child.Serialize(b.store.hasher)
+	if err != nil {
+		return err
+	}
+	if b.store.hasher.Codec.Embeds(data) {
+		return nil
+	}
+	b.store.encoded[child] = data
+	h, err := b.store.ref(child)
+	delete(b.store.encoded, child)
+	if err != nil {
+		return err
+	}
+	if err := b.unpin(child); err != nil {
+		return err
+	}
+	hn := internal.HashNode(h)
+	n.Children[slot] = &hn
+	if len(b.store.counts) >= bulkFlushSize {
+		return b.store.flush()
+	}
+	return nil
+}
+
+// unpin drops the references taken on the sealed children under node,
+// once node is stored and references them itself
+func (b *BulkBuilder) unpin(node internal.Node) error {
+	var children []internal.Node
+	switch n := node.(type) {
+	case *internal.FullNode:
+		children = n.Children[:]
+	case *internal.ShortNode:
+		children = []internal.Node{n.Value}
+	}
+	for _, child := range children {
+		switch c := child.(type) {
+		case nil:
+		case *internal.HashNode:
+			count, err := b.store.count(*c)
+			if err != nil {
+				return err
+			}
+			b.store.counts[string(*c)] = count - 1
+		default:
+			if err := b.unpin(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (b *BulkBuilder) Commit() error {
+	return b.CommitWithMetadata(nil)
+}
+
+// CommitWithMetadata writes the remaining nodes and points the trie to the built root,
+// metadata is recorded in the root history.
+func (b *BulkBuilder) CommitWithMetadata(metadata []byte) error {
+	if b.batch.closed {
+		return BatchClosed
+	}
+	err := b.commit(metadata)
+	if err != nil {
+		b.Abort()
+		return err
+	}
+	b.batch.closed = true
+	defer b.batch.unlock()
+	return b.batch.kv.Commit()
+}
+
+func (b *BulkBuilder) commit(metadata []byte) error {
+	var newRoot []byte
+	if b.root != nil {
+		h, err := b.store.ref(b.root)
+		if err != nil {
+			return err
+		}
+		if err := b.unpin(b.root); err != nil {
+			return err
+		}
+		newRoot = h
+	}
+	return b.batch.publish(b.store, newRoot, metadata)
+}
+
+func (b *BulkBuilder) Abort() error {
+	return b.batch.Abort()
+}
@@ -0,0 +1,152 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+func sortedPairs(n int) ([]string, map[string][]byte) {
+	r := rand.New(rand.NewSource(1))
+	pairs := map[string][]byte{}
+	for len(pairs) < n {
+		key := make([]byte, 1+r.Intn(6))
+		r.Read(key)
+		// few distinct values, so values and subtrees are shared
+		pairs[string(key)] = []byte(fmt.Sprint("value", r.Intn(50)))
+	}
+	keys := make([]string, 0, n)
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, pairs
+}
+
+func TestBulkBuilder(t *testing.T) {
+	keys, pairs := sortedPairs(5000)
+	for _, opts := range [][]Option{
+		nil,
+		{WithNodeCodec(BinaryCodec), WithInlineValues(8)},
+		{WithEthereum()},
+	} {
+		built := &MapKv{kv: map[string][]byte{}}
+		trie := New(crypto.SHA256.New, built, []byte("test_root"), opts...)
+		builder, err := trie.BulkBuilder(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			if err := builder.Add([]byte(k), pairs[k]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := builder.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		inserted := &MapKv{kv: map[string][]byte{}}
+		other := New(crypto.SHA256.New, inserted, []byte("test_root"), opts...)
+		batch, _ := other.Batch(nil)
+		for k, v := range pairs {
+			batch.Put([]byte(k), v)
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		// the same nodes and reference counts are stored
+		for k, v := range inserted.kv {
+			if isMetadataKey(k, []string{"test_root"}) {
+				continue
+			}
+			if !bytes.Equal(built.kv[k], v) {
+				t.Fatalf("key %x: %x, want %x", k, built.kv[k], v)
+			}
+		}
+		if len(built.kv) != len(inserted.kv) {
+			t.Fatalf("%d stored keys, want %d", len(built.kv), len(inserted.kv))
+		}
+		for _, k := range keys[:100] {
+			if v, err := trie.Get([]byte(k)); err != nil || !bytes.Equal(v, pairs[k]) {
+				t.Fatalf("get %x: %s %v", k, v, err)
+			}
+		}
+	}
+}
+
+func TestBulkBuilderMemory(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	builder, _ := trie.BulkBuilder(nil)
+	defer builder.Abort()
+	for i := 0; i < 20000; i++ {
+		if err := builder.Add([]byte(fmt.Sprintf("key%08d", i)), []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+		// only the nodes on the path of the last key are in memory
+		if n := inMemoryNodes(builder.root); n > 20 {
+			t.Fatalf("%d nodes in memory after %d keys", n, i+1)
+		}
+	}
+}
+
+func inMemoryNodes(node internal.Node) int {
+	switch n := node.(type) {
+	case *internal.FullNode:
+		count := 1
+		for _, child := range n.Children {
+			count += inMemoryNodes(child)
+		}
+		return count
+	case *internal.ShortNode:
+		return 1 + inMemoryNodes(n.Value)
+	case *internal.ValueNode:
+		return 1
+	}
+	return 0
+}
+
+func TestBulkBuilderReplacesRoot(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	for i := 0; i < 100; i++ {
+		trie.Put([]byte(fmt.Sprint("old", i)), []byte(fmt.Sprint("value", i)))
+	}
+
+	builder, _ := trie.BulkBuilder(nil)
+	for _, k := range []string{"a", "ab", "abc", "b", "old5"} {
+		if err := builder.Add([]byte(k), []byte("value5")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := builder.Add([]byte("ab"), []byte("value")); !errors.Is(err, InvalidKey) {
+		t.Fatalf("expected InvalidKey, got %v", err)
+	}
+	if err := builder.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trie.Get([]byte("old1")); !errors.Is(err, KeyNotFound) {
+		t.Fatalf("replaced key found: %v", err)
+	}
+	if v, err := trie.Get([]byte("abc")); err != nil || string(v) != "value5" {
+		t.Fatalf("get: %s %v", v, err)
+	}
+	checkStoredNodes(t, kv, "test_root")
+
+	// the built nodes are released like the ones of a batch
+	batch, _ := trie.Batch(nil)
+	for _, k := range []string{"a", "ab", "abc", "b", "old5"} {
+		batch.Delete([]byte(k))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkStoredNodes(t, kv, "test_root")
+}
@@ -0,0 +1,89 @@
+package mpt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// NodeCodec is the encoding of the nodes of a trie in kv storage, see WithNodeCodec.
+// The codec is recorded by the first commit of a trie, so the trie cannot be opened
+// with another codec afterwards.
+//
+// NodeCodec is a closed choice among ProtobufCodec, BinaryCodec and RLPCodec,
+// it cannot be implemented outside this package as the codecs encode the internal nodes.
+type NodeCodec interface {
+	// Name identifies the codec in kv storage
+	Name() string
+	codec(f format) internal.Codec
+}
+
+var (
+	// ProtobufCodec encodes the nodes as PersistNode protobuf messages, it is the default codec.
+	// Tries committed before codecs were recorded use it.
+	ProtobufCodec NodeCodec = nodeCodec{"protobuf", func(f format) internal.Codec {
+		return internal.ProtoCodec{InlineValues: f.inlineValues}
+	}}
+	// BinaryCodec encodes the nodes in a compact binary format, a full node only holds its children.
+	BinaryCodec NodeCodec = nodeCodec{"binary", func(f format) internal.Codec {
+		return internal.BinaryCodec{InlineValues: f.inlineValues}
+	}}
+	// RLPCodec encodes the nodes in RLP and embeds the nodes shorter than 32 bytes in their parent,
+	// it is the codec of Ethereum tries when the keys are split in nibbles, see WithEthereum.
+	// The values are always encoded in their parent, putting an empty value deletes the key.
+	RLPCodec NodeCodec = nodeCodec{"rlp", func(f format) internal.Codec {
+		return internal.RLPCodec{Hexary: f.hexary}
+	}}
+)
+
+type nodeCodec struct {
+	name     string
+	newCodec func(f format) internal.Codec
+}
+
+func (c nodeCodec) Name() string { return c.name }
+
+func (c nodeCodec) codec(f format) internal.Codec { return c.newCodec(f) }
+
+// checkFormat checks that the nodes of the trie at rootKey are encoded in format f,
+// hasRoot reports whether the trie has nodes
+func checkFormat(txn api.KvStorageTransaction, rootKey []byte, f format, hasRoot bool) error {
+	data, err := txn.Get(formatKey(rootKey))
+	if err != nil && !errors.Is(err, api.NotFound) {
+		return err
+	}
+	recorded := string(data)
+	if len(data) == 0 {
+		if !hasRoot {
+			return nil
+		}
+		recorded = ProtobufCodec.Name()
+	}
+	if recorded != f.id() {
+		return fmt.Errorf("[Trie] nodes are encoded with %s, not %s: %w", recorded, f.id(), CodecMismatch)
+	}
+	return nil
+}
+
+// recordFormat records the format of the trie at rootKey if it is not recorded yet
+func recordFormat(txn api.KvStorageTransaction, rootKey []byte, f format) error {
+	key := formatKey(rootKey)
+	data, err := txn.Get(key)
+	if err != nil && !errors.Is(err, api.NotFound) {
+		return err
+	}
+	if len(data) > 0 {
+		return nil
+	}
+	return txn.Put(key, []byte(f.id()))
+}
+
+func formatKey(rootKey []byte) []byte {
+	key := make([]byte, 0, len(rootKey)+len(formatSuffix))
+	key = append(key, rootKey...)
+	return append(key, formatSuffix...)
+}
+
+var formatSuffix = []byte("-codec")
@@ -0,0 +1,250 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTrieNodeCodecs(t *testing.T) {
+	for _, codec := range []NodeCodec{ProtobufCodec, BinaryCodec, RLPCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			kv := &MapKv{kv: map[string][]byte{}}
+			trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithNodeCodec(codec))
+			r := rand.New(rand.NewSource(1))
+			expected := map[string][]byte{}
+			for round := 0; round < 5; round++ {
+				batch, _ := trie.Batch(nil)
+				for i := 0; i < 100; i++ {
+					key := make([]byte, 1+r.Intn(3))
+					r.Read(key)
+					if r.Intn(4) == 0 {
+						batch.Delete(key)
+						delete(expected, string(key))
+						continue
+					}
+					value := make([]byte, 1+r.Intn(40))
+					r.Read(value)
+					if err := batch.Put(key, value); err != nil {
+						t.Fatal(err)
+					}
+					expected[string(key)] = value
+				}
+				if err := batch.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			root, _ := trie.RootHash()
+			for k, v := range expected {
+				got, err := trie.Get([]byte(k))
+				if err != nil || !bytes.Equal(got, v) {
+					t.Fatalf("get %x: %x %v, want %x", k, got, err, v)
+				}
+				proof, err := trie.Prove([]byte(k))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err = VerifyProof(crypto.SHA256.New, root, []byte(k), proof, WithNodeCodec(codec))
+				if err != nil || !bytes.Equal(got, v) {
+					t.Fatalf("verify %x: %x %v, want %x", k, got, err, v)
+				}
+			}
+
+			// removing every key leaves no node behind
+			batch, _ := trie.Batch(nil)
+			for k := range expected {
+				if err := batch.Delete([]byte(k)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := batch.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			checkStoredNodes(t, kv, "test_root")
+		})
+	}
+}
+
+func TestTrieCodecMismatch(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithNodeCodec(BinaryCodec))
+	if err := trie.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithNodeCodec(RLPCodec)},
+		{WithNodeCodec(BinaryCodec), WithEthereum()},
+	} {
+		other := New(crypto.SHA256.New, kv, []byte("test_root"), opts...)
+		if _, err := other.Get([]byte("key")); !errors.Is(err, CodecMismatch) {
+			t.Fatalf("expected CodecMismatch, got %v", err)
+		}
+	}
+	reopened := New(crypto.SHA256.New, kv, []byte("test_root"), WithNodeCodec(BinaryCodec))
+	if value, err := reopened.Get([]byte("key")); err != nil || string(value) != "value" {
+		t.Fatalf("get: %s %v", value, err)
+	}
+}
+
+func TestTrieCodecUnrecorded(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	if err := trie.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	// a trie committed before codecs were recorded is a protobuf trie
+	delete(kv.kv, string(formatKey([]byte("test_root"))))
+	other := New(crypto.SHA256.New, kv, []byte("test_root"), WithNodeCodec(BinaryCodec))
+	if _, err := other.Get([]byte("key")); !errors.Is(err, CodecMismatch) {
+		t.Fatalf("expected CodecMismatch, got %v", err)
+	}
+	if err := trie.Put([]byte("key2"), []byte("value2")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(kv.kv[string(formatKey([]byte("test_root")))]); got != ProtobufCodec.Name() {
+		t.Fatalf("recorded codec %q", got)
+	}
+}
+
+// legacyProtoCodec encodes full nodes with their 257 children like the first protobuf layout
+type legacyProtoCodec struct {
+	internal.ProtoCodec
+}
+
+func (c legacyProtoCodec) Encode(n internal.Node, h *internal.Hasher) ([]byte, error) {
+	fn, ok := n.(*internal.FullNode)
+	if !ok {
+		return c.ProtoCodec.Encode(n, h)
+	}
+	children := make([][]byte, len(fn.Children))
+	for i, child := range fn.Children {
+		if child != nil {
+			ref, err := h.Ref(child)
+			if err != nil {
+				return nil, err
+			}
+			children[i] = ref
+		}
+	}
+	return proto.Marshal(&pb.PersistNode{Content: &pb.PersistNode_Full{Full: &pb.PersistFullNode{Children: children}}})
+}
+
+func TestTrieProtobufLegacyFullNodes(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	trie.format.codec = nodeCodec{"protobuf", func(format) internal.Codec { return legacyProtoCodec{} }}
+	batch, _ := trie.Batch(nil)
+	expected := map[string]string{}
+	for i := 0; i < 100; i++ {
+		key, value := fmt.Sprintf("key%d", i), fmt.Sprintf("value%d", i)
+		batch.Put([]byte(key), []byte(value))
+		expected[key] = value
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	legacySize := 0
+	for _, v := range kv.kv {
+		legacySize += len(v)
+	}
+
+	// the nodes in the legacy layout are read, and only the changed ones are rewritten
+	trie.format.codec = ProtobufCodec
+	batch, _ = trie.Batch(nil)
+	for i := 0; i < 100; i += 3 {
+		if _, err := batch.Get([]byte(fmt.Sprintf("key%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the loaded nodes under the changed ones stay clean
+	for _, key := range []string{"key0", "key6"} {
+		if err := batch.Delete([]byte(key)); err != nil {
+			t.Fatal(err)
+		}
+		delete(expected, key)
+	}
+	batch.Put([]byte("new"), []byte("value"))
+	expected["new"] = "value"
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range expected {
+		got, err := trie.Get([]byte(k))
+		if err != nil || string(got) != v {
+			t.Fatalf("get %s: %s %v", k, got, err)
+		}
+	}
+	checkStoredNodes(t, kv, "test_root")
+
+	// a trie of the sparse layout is smaller
+	sparse := &MapKv{kv: map[string][]byte{}}
+	sparseTrie := New(crypto.SHA256.New, sparse, []byte("test_root"))
+	batch, _ = sparseTrie.Batch(nil)
+	for i := 0; i < 100; i++ {
+		batch.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	sparseSize := 0
+	for _, v := range sparse.kv {
+		sparseSize += len(v)
+	}
+	if sparseSize >= legacySize {
+		t.Fatalf("sparse layout takes %d bytes, legacy layout %d", sparseSize, legacySize)
+	}
+}
+
+func TestTrieProtobufLegacyUncountedNodes(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	trie.format.codec = nodeCodec{"protobuf", func(format) internal.Codec { return legacyProtoCodec{} }}
+	batch, _ := trie.Batch(nil)
+	for i := 0; i < 100; i++ {
+		batch.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the nodes were written before reference counting
+	for k := range kv.kv {
+		if bytes.HasPrefix([]byte(k), refCountPrefix) {
+			delete(kv.kv, k)
+		}
+	}
+
+	// the clean loaded nodes are counted under the hash they are stored with
+	trie.format.codec = ProtobufCodec
+	batch, _ = trie.Batch(nil)
+	for i := 0; i < 100; i++ {
+		if _, err := batch.Get([]byte(fmt.Sprintf("key%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	batch.Put([]byte("new"), []byte("value"))
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	live := map[string]bool{}
+	reachable(t, kv, kv.kv["test_root"], live)
+	for k := range kv.kv {
+		if bytes.HasPrefix([]byte(k), refCountPrefix) && !live[k[len(refCountPrefix):]] {
+			t.Fatalf("reference count of unreachable node %x", k[len(refCountPrefix):])
+		}
+	}
+	for k := range live {
+		if _, ok := kv.kv[string(refCountKey([]byte(k)))]; !ok {
+			t.Fatalf("reachable node %x is not counted", k)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvstore"
+)
+
+func TestTrieConcurrentReaders(t *testing.T) {
+	s := kvstore.NewMemKVStore()
+	trie := New(crypto.SHA256.New, s, []byte("root"))
+	const keys = 20
+	// every commit writes the same version to all the keys,
+	// so a reader must never see two versions at once
+	commit := func(version int) error {
+		batch, err := trie.Batch(nil)
+		if err != nil {
+			return err
+		}
+		for k := 0; k < keys; k++ {
+			if err := batch.Put([]byte(fmt.Sprint("key", k)), []byte(fmt.Sprint(version))); err != nil {
+				batch.Abort()
+				return err
+			}
+		}
+		return batch.Commit()
+	}
+	if err := commit(0); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				it, err := trie.Iterator(nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var version []byte
+				n := 0
+				for it.Next() {
+					if version != nil && !bytes.Equal(version, it.Value()) {
+						t.Errorf("versions %s and %s in the same snapshot", version, it.Value())
+					}
+					version = it.Value()
+					n++
+				}
+				if err := it.Err(); err != nil || n != keys {
+					t.Errorf("iterated %d keys: %v", n, err)
+				}
+				it.Close()
+				if _, err := trie.Get([]byte("key0")); err != nil {
+					t.Error(err)
+				}
+				if _, err := trie.Prove([]byte("key1")); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+
+	// concurrent writers are serialized, none of them conflicts
+	var writers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		writers.Add(1)
+		go func(w int) {
+			defer writers.Done()
+			for v := 1; v <= 10; v++ {
+				if err := commit(w*100 + v); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	writers.Wait()
+	close(done)
+	wg.Wait()
+
+	history, err := trie.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 41 {
+		t.Fatalf("%d commits recorded, want 41", len(history))
+	}
+}
+
+func TestTriePruneWhileCommitting(t *testing.T) {
+	// out of archive mode the commits release the nodes of the replaced roots meanwhile
+	for name, archive := range map[string]bool{"archive": true, "current": false} {
+		t.Run(name, func(t *testing.T) {
+			testPruneWhileCommitting(t, archive)
+		})
+	}
+}
+
+func testPruneWhileCommitting(t *testing.T, archive bool) {
+	s := kvstore.NewMemKVStore()
+	opts := []Option{WithPruneBatchSize(2)}
+	if archive {
+		opts = append(opts, WithArchive())
+	}
+	trie := New(crypto.SHA256.New, s, []byte("root"), opts...)
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := trie.Prune(nil); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	// the commits never conflict with the pages of the sweep
+	for i := 0; i < 1000; i++ {
+		if err := trie.Put([]byte(fmt.Sprint("key", i%20)), []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if err := trie.Prune(nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 980; i < 1000; i++ {
+		val, err := trie.Get([]byte(fmt.Sprint("key", i%20)))
+		if err != nil || string(val) != fmt.Sprint(i) {
+			t.Fatalf("get key%d: %s %v", i%20, val, err)
+		}
+	}
+
+	// nothing is left once every key is deleted and pruned
+	batch, _ := trie.Batch(nil)
+	for i := 0; i < 20; i++ {
+		batch.Delete([]byte(fmt.Sprint("key", i)))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := trie.Prune(nil); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := s.Keys(nil, 1000)
+	for _, key := range keys {
+		if len(key) == crypto.SHA256.Size() || bytes.HasPrefix(key, refCountPrefix) {
+			t.Fatalf("node or count %x left", key)
+		}
+	}
+}
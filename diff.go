@@ -0,0 +1,202 @@
+package mpt
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+type ChangeKind uint8
+
+const (
+	KeyAdded ChangeKind = iota
+	KeyRemoved
+	KeyModified
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case KeyAdded:
+		return "ADDED"
+	case KeyRemoved:
+		return "REMOVED"
+	case KeyModified:
+		return "MODIFIED"
+	default:
+		return "UNKNOWN CHANGE"
+	}
+}
+
+// Change is a key whose value differs between two roots
+type Change struct {
+	Kind     ChangeKind
+	Key      []byte
+	OldValue []byte
+	NewValue []byte
+}
+
+// diffCursor is a subtree at some path, a short node is partially consumed
+// when the other side of the diff branches inside its key
+type diffCursor struct {
+	node   internal.Node
+	offset int
+}
+
+// Diff calls fn in key order for every key added, removed or modified from rootA to rootB,
+// a nil root is the empty trie. Subtrees with the same hash on both sides are skipped,
+// so only the nodes on the changed paths are loaded. The iteration stops at the first error of fn.
+func (t *Trie) Diff(rootA, rootB []byte, fn func(Change) error) error {
+	txn, err := t.kv.Transaction()
+	if err != nil {
+		return err
+	}
+	defer txn.Abort()
+	batch := &Batch{kv: txn, format: t.format}
+	return batch.diff(rootCursor(rootA), rootCursor(rootB), nil, fn)
+}
+
+func rootCursor(rootHash []byte) diffCursor {
+	if len(rootHash) == 0 {
+		return diffCursor{}
+	}
+	hn := internal.HashNode(rootHash)
+	return diffCursor{node: &hn}
+}
+
+func (b *Batch) diff(a, c diffCursor, path []byte, fn func(Change) error) error {
+	if a.node == nil && c.node == nil {
+		return nil
+	}
+	// a value encoded in its parent has no reference of its own
+	if a.node != nil && c.node != nil && a.offset == 0 && c.offset == 0 &&
+		a.node.CachedHash() != nil && bytes.Equal(a.node.CachedHash(), c.node.CachedHash()) {
+		return nil
+	}
+	var err error
+	if a, err = b.normalize(a, path); err != nil {
+		return err
+	}
+	if c, err = b.normalize(c, path); err != nil {
+		return err
+	}
+	if a.node == nil {
+		return b.diffSubtree(c, path, KeyAdded, fn)
+	}
+	if c.node == nil {
+		return b.diffSubtree(a, path, KeyRemoved, fn)
+	}
+
+	valueA, err := b.diffValue(a, path)
+	if err != nil {
+		return err
+	}
+	valueC, err := b.diffValue(c, path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case valueA == nil && valueC != nil:
+		err = fn(Change{Kind: KeyAdded, Key: b.key(path), NewValue: valueC.Value})
+	case valueA != nil && valueC == nil:
+		err = fn(Change{Kind: KeyRemoved, Key: b.key(path), OldValue: valueA.Value})
+	case valueA != nil && !bytes.Equal(valueA.Value, valueC.Value):
+		err = fn(Change{Kind: KeyModified, Key: b.key(path), OldValue: valueA.Value, NewValue: valueC.Value})
+	}
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < 256; i++ {
+		childA, childC := diffChild(a, byte(i)), diffChild(c, byte(i))
+		if childA.node == nil && childC.node == nil {
+			continue
+		}
+		err = b.diff(childA, childC, appendPath(path, byte(i)), fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalize loads a hash node at path and moves past the end of a consumed short node
+func (b *Batch) normalize(c diffCursor, path []byte) (diffCursor, error) {
+	for {
+		switch n := c.node.(type) {
+		case *internal.HashNode:
+			loadedNode, err := b.resolve(n, path)
+			if err != nil {
+				return c, err
+			}
+			c.node = loadedNode
+		case *internal.ShortNode:
+			if c.offset < len(n.Key) {
+				return c, nil
+			}
+			c = diffCursor{node: n.Value}
+		default:
+			return c, nil
+		}
+	}
+}
+
+// diffValue returns the value node stored at the path of c, if any
+func (b *Batch) diffValue(c diffCursor, path []byte) (*internal.ValueNode, error) {
+	var node internal.Node
+	switch n := c.node.(type) {
+	case *internal.ValueNode:
+		return n, nil
+	case *internal.FullNode:
+		node = n.Children[256]
+	}
+	if hn, ok := node.(*internal.HashNode); ok {
+		loadedNode, err := b.resolve(hn, path)
+		if err != nil {
+			return nil, err
+		}
+		node = loadedNode
+	}
+	if node == nil {
+		return nil, nil
+	}
+	if vn, ok := node.(*internal.ValueNode); ok {
+		return vn, nil
+	}
+	return nil, errors.New("[Trie Diff] Unexpected node in value slot")
+}
+
+// diffChild returns the subtree of c under the next key byte i
+func diffChild(c diffCursor, i byte) diffCursor {
+	switch n := c.node.(type) {
+	case *internal.FullNode:
+		return diffCursor{node: n.Children[i]}
+	case *internal.ShortNode:
+		if n.Key[c.offset] == i {
+			return diffCursor{node: n, offset: c.offset + 1}
+		}
+	}
+	return diffCursor{}
+}
+
+// diffSubtree reports every key of a subtree present on one side only
+func (b *Batch) diffSubtree(c diffCursor, path []byte, kind ChangeKind, fn func(Change) error) error {
+	node := c.node
+	if sn, ok := node.(*internal.ShortNode); ok && c.offset > 0 {
+		node = &internal.ShortNode{Key: sn.Key[c.offset:], Value: sn.Value}
+	}
+	it := &Iterator{batch: b}
+	it.push(node, path)
+	for it.Next() {
+		change := Change{Kind: kind, Key: it.Key()}
+		if kind == KeyAdded {
+			change.NewValue = it.Value()
+		} else {
+			change.OldValue = it.Value()
+		}
+		if err := fn(change); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
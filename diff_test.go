@@ -0,0 +1,140 @@
+package mpt
+
+import (
+	"crypto"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+type countingKv struct {
+	*MapKv
+	gets int
+}
+
+func (c *countingKv) Transaction() (api.KvStorageTransaction, error) {
+	return &countingKvTransaction{MapKvTransaction{mapkv: c.MapKv}, c}, nil
+}
+
+type countingKvTransaction struct {
+	MapKvTransaction
+	kv *countingKv
+}
+
+func (c *countingKvTransaction) Get(key []byte) ([]byte, error) {
+	c.kv.gets++
+	return c.MapKvTransaction.Get(key)
+}
+
+func expectedChanges(a, b map[string]string) []string {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	var ret []string
+	for _, k := range sorted {
+		oldValue, inA := a[k]
+		newValue, inB := b[k]
+		switch {
+		case !inA:
+			ret = append(ret, fmt.Sprint(KeyAdded, " ", k, " ", " ", newValue))
+		case !inB:
+			ret = append(ret, fmt.Sprint(KeyRemoved, " ", k, " ", oldValue, " "))
+		case oldValue != newValue:
+			ret = append(ret, fmt.Sprint(KeyModified, " ", k, " ", oldValue, " ", newValue))
+		}
+	}
+	return ret
+}
+
+func diffChanges(t *testing.T, trie *Trie, rootA, rootB []byte) []string {
+	var ret []string
+	err := trie.Diff(rootA, rootB, func(c Change) error {
+		ret = append(ret, fmt.Sprint(c.Kind, " ", string(c.Key), " ", string(c.OldValue), " ", string(c.NewValue)))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestTrieDiff(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithArchive())
+	r := rand.New(rand.NewSource(1))
+	var roots [][]byte
+	var snapshots []map[string]string
+	expected := map[string]string{}
+	roots = append(roots, nil)
+	snapshots = append(snapshots, map[string]string{})
+	for i := 0; i < 20; i++ {
+		batch, _ := trie.Batch(nil)
+		for op := 0; op < 4; op++ {
+			key := randomKeys(30)[r.Intn(30)]
+			if _, ok := expected[key]; ok && r.Intn(3) == 0 {
+				batch.Delete([]byte(key))
+				delete(expected, key)
+				continue
+			}
+			value := fmt.Sprint("value", r.Intn(3))
+			batch.Put([]byte(key), []byte(value))
+			expected[key] = value
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		rootHash, _ := trie.RootHash()
+		roots = append(roots, rootHash)
+		snapshot := map[string]string{}
+		for k, v := range expected {
+			snapshot[k] = v
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	for i := range roots {
+		for j := range roots {
+			got := diffChanges(t, trie, roots[i], roots[j])
+			want := expectedChanges(snapshots[i], snapshots[j])
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("diff %d -> %d: expected %v, got %v", i, j, want, got)
+			}
+		}
+	}
+}
+
+func TestTrieDiffSkipsSharedSubtrees(t *testing.T) {
+	kv := &countingKv{MapKv: &MapKv{kv: map[string][]byte{}}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithArchive())
+	batch, _ := trie.Batch(nil)
+	for i := 0; i < 1000; i++ {
+		batch.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("value"))
+	}
+	batch.Commit()
+	rootA, _ := trie.RootHash()
+	trie.Put([]byte("key0500"), []byte("modified"))
+	rootB, _ := trie.RootHash()
+
+	kv.gets = 0
+	got := diffChanges(t, trie, rootA, rootB)
+	if fmt.Sprint(got) != fmt.Sprint([]string{"MODIFIED key0500 value modified"}) {
+		t.Fatalf("unexpected changes %v", got)
+	}
+	if kv.gets > 20 {
+		t.Fatalf("%d nodes loaded for a single change", kv.gets)
+	}
+}
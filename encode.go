@@ -0,0 +1,94 @@
+package mpt
+
+import (
+	"sync"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// encoder serializes the dirty nodes of a batch before they are stored.
+// The dirty children of a node are serialized by up to workers goroutines,
+// each with its own hasher, a child is serialized by the current goroutine when none is free.
+// Sibling subtrees share no node, so they are serialized independently.
+type encoder struct {
+	newHasher func() *internal.Hasher
+	// holds a token per running goroutine
+	workers chan struct{}
+
+	mu      sync.Mutex
+	encoded map[internal.Node][]byte
+}
+
+// newEncoder creates an encoder running up to workers goroutines, including the calling one
+func newEncoder(newHasher func() *internal.Hasher, workers int) *encoder {
+	if workers < 1 {
+		workers = 1
+	}
+	return &encoder{
+		newHasher: newHasher,
+		workers:   make(chan struct{}, workers-1),
+		encoded:   map[internal.Node][]byte{},
+	}
+}
+
+// encode serializes the dirty nodes under node, children first
+// so that serializing a parent never recurses into its children.
+func (e *encoder) encode(node internal.Node, hasher *internal.Hasher) error {
+	if !needsEncoding(node) {
+		return nil
+	}
+	switch n := node.(type) {
+	case *internal.FullNode:
+		var wg sync.WaitGroup
+		errs := make([]error, len(n.Children))
+		for i, child := range n.Children {
+			if !needsEncoding(child) || hasher.Codec.InParent(n, i, child) {
+				continue
+			}
+			select {
+			case e.workers <- struct{}{}:
+				wg.Add(1)
+				go func(i int, child internal.Node) {
+					defer func() {
+						<-e.workers
+						wg.Done()
+					}()
+					errs[i] = e.encode(child, e.newHasher())
+				}(i, child)
+			default:
+				errs[i] = e.encode(child, hasher)
+			}
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+	case *internal.ShortNode:
+		if !hasher.Codec.InParent(n, 0, n.Value) {
+			if err := e.encode(n.Value, hasher); err != nil {
+				return err
+			}
+		}
+	}
+	data, err := node.Serialize(hasher)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.encoded[node] = data
+	e.mu.Unlock()
+	return nil
+}
+
+// needsEncoding reports whether node has changed since it was loaded or serialized
+func needsEncoding(node internal.Node) bool {
+	if node == nil {
+		return false
+	}
+	if _, ok := node.(*internal.HashNode); ok {
+		return false
+	}
+	return internal.IsDirty(node) || node.CachedHash() == nil
+}
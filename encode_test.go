@@ -0,0 +1,83 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+// recordingKv records the sequence of writes of the transactions
+type recordingKv struct {
+	*MapKv
+	writes []string
+}
+
+func (r *recordingKv) Transaction() (api.KvStorageTransaction, error) {
+	return &recordingKvTransaction{MapKvTransaction{mapkv: r.MapKv}, r}, nil
+}
+
+type recordingKvTransaction struct {
+	MapKvTransaction
+	kv *recordingKv
+}
+
+func (r *recordingKvTransaction) Put(key, val []byte) error {
+	r.kv.writes = append(r.kv.writes, fmt.Sprintf("put %x %x", key, val))
+	return r.MapKvTransaction.Put(key, val)
+}
+
+func (r *recordingKvTransaction) Delete(key []byte) error {
+	r.kv.writes = append(r.kv.writes, fmt.Sprintf("delete %x", key))
+	return r.MapKvTransaction.Delete(key)
+}
+
+func TestTrieCommitWorkers(t *testing.T) {
+	for _, opts := range [][]Option{
+		nil,
+		{WithNodeCodec(BinaryCodec), WithInlineValues(8)},
+		{WithEthereum()},
+	} {
+		var stores []*recordingKv
+		var roots [][]byte
+		for _, workers := range []int{1, 8} {
+			kv := &recordingKv{MapKv: &MapKv{kv: map[string][]byte{}}}
+			trie := New(crypto.SHA256.New, kv, []byte("test_root"), append(opts, WithCommitWorkers(workers))...)
+			r := rand.New(rand.NewSource(1))
+			for round := 0; round < 3; round++ {
+				batch, _ := trie.Batch(nil)
+				for i := 0; i < 2000; i++ {
+					key := make([]byte, 1+r.Intn(8))
+					r.Read(key)
+					if r.Intn(5) == 0 {
+						batch.Delete(key)
+						continue
+					}
+					if err := batch.Put(key, []byte(fmt.Sprintf("value%d", r.Intn(1000)))); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := batch.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root, _ := trie.RootHash()
+			stores, roots = append(stores, kv), append(roots, root)
+		}
+		if !bytes.Equal(roots[0], roots[1]) {
+			t.Fatalf("root %x with one worker, %x with eight", roots[0], roots[1])
+		}
+		// the same writes are made in the same order whatever the number of workers
+		if len(stores[0].writes) != len(stores[1].writes) {
+			t.Fatalf("%d writes with one worker, %d with eight", len(stores[0].writes), len(stores[1].writes))
+		}
+		for i, w := range stores[0].writes {
+			if w != stores[1].writes[i] {
+				t.Fatalf("write %d differs: %q with one worker, %q with eight", i, w, stores[1].writes[i])
+			}
+		}
+	}
+}
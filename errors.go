@@ -0,0 +1,57 @@
+package mpt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+var (
+	// KeyNotFound is returned when a key is not in the trie,
+	// it is api.NotFound so that kv storage errors match it too
+	KeyNotFound = api.NotFound
+	// CorruptedNode is returned when a stored node is missing or cannot be decoded
+	CorruptedNode = errors.New("corrupted node")
+	// HashMismatch is returned when the content of a stored node does not match its hash
+	HashMismatch = errors.New("node hash mismatch")
+	// InvalidKey is returned when a key cannot be stored in the trie
+	InvalidKey = errors.New("invalid key")
+	// BatchClosed is returned when a committed or aborted batch is used
+	BatchClosed = errors.New("batch closed")
+	// CodecMismatch is returned when a trie is opened with another codec than the one of its nodes
+	CodecMismatch = errors.New("codec mismatch")
+	// ReadOnly is returned when a read-only view of a trie is written
+	ReadOnly = errors.New("trie is read-only")
+	// KeyExists is returned when the absence of a key which is in the trie is proved
+	KeyExists = errors.New("key exists")
+	// InvalidProof is returned when a proof does not match the root hash or the key
+	InvalidProof = errors.New("invalid proof")
+	// UnknownVersion is returned when a version is not in the root history
+	UnknownVersion = errors.New("unknown version")
+	// NotIterable is returned by Prune when the kv storage does not implement api.IterableKvStorage
+	NotIterable = errors.New("kv storage cannot enumerate keys")
+	// PruneRunning is returned when Prune is called while another prune of the trie runs
+	PruneRunning = errors.New("another prune is running")
+)
+
+// NodeError is a failure on a stored node, it carries the hash of the node
+// and the key path from the root to the node, when it is known.
+// Err is CorruptedNode, HashMismatch or the error of the kv storage.
+type NodeError struct {
+	Op   string
+	Hash []byte
+	Path []byte
+	Err  error
+}
+
+func (e *NodeError) Error() string {
+	if e.Path == nil {
+		return fmt.Sprintf("[Trie Node] %s node %x: %s", e.Op, e.Hash, e.Err.Error())
+	}
+	return fmt.Sprintf("[Trie Node] %s node %x at path %x: %s", e.Op, e.Hash, e.Path, e.Err.Error())
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,140 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// newErrorTrie stores "abc" and "abd", the root is a short node "ab"
+// pointing to a full node, whose hash is returned
+func newErrorTrie(t *testing.T, opts ...Option) (*Trie, *MapKv, []byte) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), opts...)
+	batch, _ := trie.Batch(nil)
+	batch.Put([]byte("abc"), []byte("1"))
+	batch.Put([]byte("abd"), []byte("2"))
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root, err := internal.DeserializeNode(internal.NewHasher(crypto.SHA256.New(), internal.ProtoCodec{}), kv.kv[string(kv.kv["test_root"])])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trie, kv, root.(*internal.ShortNode).Value.CachedHash()
+}
+
+func expectNodeError(t *testing.T, err error, target error, h, path []byte) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("expected %v, got %v", target, err)
+	}
+	var nodeErr *NodeError
+	if !errors.As(err, &nodeErr) {
+		t.Fatalf("expected a NodeError, got %v", err)
+	}
+	if !bytes.Equal(nodeErr.Hash, h) || !bytes.Equal(nodeErr.Path, path) {
+		t.Fatalf("node %x at path %q reported for node %x at path %q", nodeErr.Hash, nodeErr.Path, h, path)
+	}
+}
+
+func TestTrieKeyNotFound(t *testing.T) {
+	trie, _, _ := newErrorTrie(t)
+	_, err := trie.Get([]byte("abe"))
+	if !errors.Is(err, KeyNotFound) || !errors.Is(err, api.NotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
+
+func TestTrieCorruptedNode(t *testing.T) {
+	// cached nodes are not read again from kv storage
+	trie, kv, h := newErrorTrie(t, WithNodeCache(0))
+	stored := kv.kv[string(h)]
+
+	// content changed under the same hash
+	other, _ := trie.Prove([]byte("abc"))
+	kv.kv[string(h)] = other[len(other)-1]
+	_, err := trie.Get([]byte("abc"))
+	expectNodeError(t, err, HashMismatch, h, []byte("ab"))
+
+	// content which is not a node
+	kv.kv[string(h)] = []byte("garbage")
+	_, err = trie.Get([]byte("abc"))
+	expectNodeError(t, err, CorruptedNode, h, []byte("ab"))
+
+	// missing node, it is not reported as a missing key
+	delete(kv.kv, string(h))
+	_, err = trie.Get([]byte("abc"))
+	expectNodeError(t, err, CorruptedNode, h, []byte("ab"))
+	if errors.Is(err, KeyNotFound) {
+		t.Fatal("missing node reported as missing key")
+	}
+	err = trie.Put([]byte("abe"), []byte("3"))
+	expectNodeError(t, err, CorruptedNode, h, []byte("ab"))
+
+	kv.kv[string(h)] = stored
+	if _, err := trie.Get([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchClosed(t *testing.T) {
+	trie, _, _ := newErrorTrie(t)
+	batch, _ := trie.Batch(nil)
+	batch.Put([]byte("abe"), []byte("3"))
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Put([]byte("abf"), []byte("4")); !errors.Is(err, BatchClosed) {
+		t.Fatalf("expected BatchClosed, got %v", err)
+	}
+	if _, err := batch.Get([]byte("abe")); !errors.Is(err, BatchClosed) {
+		t.Fatalf("expected BatchClosed, got %v", err)
+	}
+	if err := batch.Commit(); !errors.Is(err, BatchClosed) {
+		t.Fatalf("expected BatchClosed, got %v", err)
+	}
+	if err := batch.Abort(); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, _ = trie.Batch(nil)
+	batch.Abort()
+	if err := batch.Delete([]byte("abe")); !errors.Is(err, BatchClosed) {
+		t.Fatalf("expected BatchClosed, got %v", err)
+	}
+	it := batch.Iterator(nil)
+	if it.Next() || !errors.Is(it.Err(), BatchClosed) {
+		t.Fatalf("expected BatchClosed, got %v", it.Err())
+	}
+}
+
+func TestTrieUnknownVersion(t *testing.T) {
+	trie, _, _ := newErrorTrie(t)
+	for _, version := range []uint64{0, 2} {
+		if err := trie.Rollback(version); !errors.Is(err, UnknownVersion) {
+			t.Fatalf("expected UnknownVersion for version %d, got %v", version, err)
+		}
+	}
+}
+
+func TestTriePruneErrors(t *testing.T) {
+	_, kv, _ := newErrorTrie(t)
+	// the storage hides the Keys method of MapKv
+	trie := New(crypto.SHA256.New, struct{ api.TransactionalKvStorage }{kv}, []byte("test_root"))
+	if err := trie.Prune(nil); !errors.Is(err, NotIterable) {
+		t.Fatalf("expected NotIterable, got %v", err)
+	}
+
+	trie = New(crypto.SHA256.New, kv, []byte("test_root"))
+	trie.guard.active = true
+	if err := trie.Prune(nil); !errors.Is(err, PruneRunning) {
+		t.Fatalf("expected PruneRunning, got %v", err)
+	}
+}
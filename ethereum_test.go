@@ -0,0 +1,216 @@
+package mpt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// root hashes from the trie tests of github.com/ethereum/tests
+func TestEthereumRootVectors(t *testing.T) {
+	type op struct {
+		key, value string
+	}
+	cases := []struct {
+		name string
+		ops  []op
+		root string
+	}{
+		{
+			name: "dogs",
+			ops:  []op{{"doe", "reindeer"}, {"dog", "puppy"}, {"dogglesworth", "cat"}},
+			root: "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3",
+		},
+		{
+			name: "foo",
+			ops:  []op{{"foo", "bar"}, {"food", "bass"}},
+			root: "17beaa1648bafa633cda809c90c04af50fc8aed3cb40d16efbddee6fdf63c4c3",
+		},
+		{
+			// an empty value deletes the key
+			name: "emptyValues",
+			ops: []op{
+				{"do", "verb"}, {"ether", "wookiedoo"}, {"horse", "stallion"}, {"shaman", "horse"},
+				{"doge", "coin"}, {"ether", ""}, {"dog", "puppy"}, {"shaman", ""},
+			},
+			root: "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			trie := NewEthereum(&MapKv{kv: map[string][]byte{}}, []byte("test_root"))
+			batch, _ := trie.Batch(nil)
+			for _, o := range c.ops {
+				if err := batch.Put([]byte(o.key), []byte(o.value)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := batch.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			root, err := trie.RootHash()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(root) != c.root {
+				t.Fatalf("root %x, want %s", root, c.root)
+			}
+		})
+	}
+}
+
+func TestEthereumReload(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := NewEthereum(kv, []byte("test_root"))
+	r := rand.New(rand.NewSource(1))
+	expected := map[string][]byte{}
+	for round := 0; round < 5; round++ {
+		batch, _ := trie.Batch(nil)
+		for i := 0; i < 100; i++ {
+			// short keys and values make embedded nodes
+			key := make([]byte, 1+r.Intn(4))
+			r.Read(key)
+			value := make([]byte, 1+r.Intn(40))
+			r.Read(value)
+			if r.Intn(4) == 0 {
+				err := batch.Delete(key)
+				if _, ok := expected[string(key)]; ok != (err == nil) {
+					t.Fatalf("delete %x: %v", key, err)
+				}
+				delete(expected, string(key))
+				continue
+			}
+			if err := batch.Put(key, value); err != nil {
+				t.Fatal(err)
+			}
+			expected[string(key)] = value
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	batch, _ := trie.Batch(nil)
+	defer batch.Abort()
+	for k, v := range expected {
+		got, err := batch.Get([]byte(k))
+		if err != nil || !bytes.Equal(got, v) {
+			t.Fatalf("get %x: %x %v, want %x", k, got, err, v)
+		}
+	}
+
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	it := batch.Iterator(nil)
+	i := 0
+	for ; it.Next(); i++ {
+		if i >= len(keys) || string(it.Key()) != keys[i] {
+			t.Fatalf("iterator key %d: %x", i, it.Key())
+		}
+	}
+	if it.Err() != nil || i != len(keys) {
+		t.Fatalf("iterated %d keys of %d: %v", i, len(keys), it.Err())
+	}
+
+	// the trie built in one batch has the same root
+	other := NewEthereum(&MapKv{kv: map[string][]byte{}}, []byte("test_root"))
+	otherBatch, _ := other.Batch(nil)
+	for k, v := range expected {
+		otherBatch.Put([]byte(k), v)
+	}
+	if err := otherBatch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root, _ := trie.RootHash()
+	otherRoot, _ := other.RootHash()
+	if !bytes.Equal(root, otherRoot) {
+		t.Fatalf("root %x, want %x", otherRoot, root)
+	}
+}
+
+func TestEthereumProof(t *testing.T) {
+	trie := NewEthereum(&MapKv{kv: map[string][]byte{}}, []byte("test_root"))
+	batch, _ := trie.Batch(nil)
+	for i := 0; i < 50; i++ {
+		batch.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("v%d", i)))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root, _ := trie.RootHash()
+
+	for i := 0; i < 50; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		proof, err := trie.Prove(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := VerifyProof(sha3.NewLegacyKeccak256, root, key, proof, WithEthereum())
+		if err != nil || string(value) != fmt.Sprintf("v%d", i) {
+			t.Fatalf("verify %s: %s %v", key, value, err)
+		}
+	}
+	for _, key := range []string{"key", "key50", "kex", "other"} {
+		proof, err := trie.ProveAbsence([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyAbsenceProof(sha3.NewLegacyKeccak256, root, []byte(key), proof, WithEthereum()); err != nil {
+			t.Fatalf("verify absence %s: %v", key, err)
+		}
+	}
+}
+
+func TestEthereumDiff(t *testing.T) {
+	trie := NewEthereum(&MapKv{kv: map[string][]byte{}}, []byte("test_root"), WithArchive())
+	trie.Put([]byte("doe"), []byte("reindeer"))
+	trie.Put([]byte("dog"), []byte("puppy"))
+	rootA, _ := trie.RootHash()
+	trie.Put([]byte("dog"), []byte("hound"))
+	trie.Put([]byte("dogglesworth"), []byte("cat"))
+	rootB, _ := trie.RootHash()
+
+	var changes []string
+	err := trie.Diff(rootA, rootB, func(c Change) error {
+		changes = append(changes, fmt.Sprintf("%s %s", c.Kind, c.Key))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"MODIFIED dog", "ADDED dogglesworth"}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Fatalf("changes %v, want %v", changes, want)
+	}
+}
+
+func TestEthereumEmptyValue(t *testing.T) {
+	trie := NewEthereum(&MapKv{kv: map[string][]byte{}}, []byte("test_root"))
+	batch, _ := trie.Batch(nil)
+	batch.Put([]byte("dog"), []byte("puppy"))
+	batch.Put([]byte("doge"), []byte("coin"))
+	// an empty value deletes the key, or does nothing for a missing key
+	for _, key := range []string{"doge", "horse"} {
+		if err := batch.Put([]byte(key), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := trie.Get([]byte("dog")); err != nil || string(v) != "puppy" {
+		t.Fatalf("get dog: %s %v", v, err)
+	}
+	if _, err := trie.Get([]byte("doge")); !errors.Is(err, KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+}
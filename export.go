@@ -0,0 +1,167 @@
+package mpt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// Export streams the nodes reachable from the root of the trie to w
+// as length-delimited PersistKV records. The first record has an empty key
+// and the root hash as value, then every node is written once, after its parent.
+func (t *Trie) Export(w io.Writer) error {
+	txn, err := t.kv.Transaction()
+	if err != nil {
+		return err
+	}
+	defer txn.Abort()
+	root, err := t.loadRoot(txn)
+	if err != nil {
+		return err
+	}
+	var rootHash []byte
+	if root != nil {
+		rootHash = root.CachedHash()
+	}
+	if _, err := protodelim.MarshalTo(w, &pb.PersistKV{Value: rootHash}); err != nil {
+		return err
+	}
+	if root == nil {
+		return nil
+	}
+
+	hasher := t.hasher()
+	visited := map[string]struct{}{}
+	pending := [][]byte{rootHash}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := visited[string(h)]; ok {
+			continue
+		}
+		visited[string(h)] = struct{}{}
+		// the stored bytes are exported, the node is decoded for its children
+		data, err := txn.Get(h)
+		if errors.Is(err, api.NotFound) {
+			err = fmt.Errorf("%w: missing from kv storage", CorruptedNode)
+		}
+		if err != nil {
+			return &NodeError{Op: "export", Hash: h, Err: err}
+		}
+		node, err := internal.DeserializeNode(hasher, data)
+		if err != nil {
+			return &NodeError{Op: "export", Hash: h, Err: fmt.Errorf("%w: %w", CorruptedNode, err)}
+		}
+		if !bytes.Equal(h, node.CachedHash()) {
+			return &NodeError{Op: "export", Hash: h, Err: HashMismatch}
+		}
+		if _, err := protodelim.MarshalTo(w, &pb.PersistKV{Key: h, Value: data}); err != nil {
+			return err
+		}
+		// push in reverse order so the children are written in key order
+		children, err := childHashes(hasher, node)
+		if err != nil {
+			return err
+		}
+		for i := len(children) - 1; i >= 0; i-- {
+			pending = append(pending, children[i])
+		}
+	}
+	return nil
+}
+
+// Import reads a stream written by Export into the kv storage of the trie.
+// Every node must hash to its key and be referred by a node read before it,
+// the nodes are written and the trie is pointed to the imported root in one transaction,
+// once all the nodes of the root are read.
+func (t *Trie) Import(r io.Reader) error {
+	if t.readOnly {
+		return ReadOnly
+	}
+	reader := bufio.NewReader(r)
+	header := &pb.PersistKV{}
+	if err := protodelim.UnmarshalFrom(reader, header); err != nil {
+		return fmt.Errorf("[Trie Import] Cannot read header: %w", err)
+	}
+	if len(header.Key) != 0 {
+		return errors.New("[Trie Import] invalid header")
+	}
+	rootHash := header.Value
+
+	t.writer.Lock()
+	defer t.writer.Unlock()
+	txn, err := t.kv.Transaction()
+	if err != nil {
+		return err
+	}
+	err = t.importNodes(txn, reader, rootHash)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	// the nodes are written, count their references from the new root in the same transaction
+	err = t.pointRoot(txn, &pb.PersistRootRecord{Root: rootHash})
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	return txn.Commit()
+}
+
+func (t *Trie) importNodes(txn api.KvStorageTransaction, reader *bufio.Reader, rootHash []byte) error {
+	hasher := t.hasher()
+	pending := map[string]struct{}{}
+	received := map[string]struct{}{}
+	if len(rootHash) > 0 {
+		pending[string(rootHash)] = struct{}{}
+	}
+	for {
+		record := &pb.PersistKV{}
+		err := protodelim.UnmarshalFrom(reader, record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("[Trie Import] Cannot read node: %w", err)
+		}
+		if _, ok := pending[string(record.Key)]; !ok {
+			return fmt.Errorf("[Trie Import] unexpected node %x: %w", record.Key, CorruptedNode)
+		}
+		h, err := internal.Hash(hasher, record.Value)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(h, record.Key) {
+			return &NodeError{Op: "import", Hash: record.Key, Err: HashMismatch}
+		}
+		node, err := internal.DeserializeNode(hasher, record.Value)
+		if err != nil {
+			return &NodeError{Op: "import", Hash: record.Key, Err: fmt.Errorf("%w: %w", CorruptedNode, err)}
+		}
+		delete(pending, string(record.Key))
+		received[string(record.Key)] = struct{}{}
+		children, err := childHashes(hasher, node)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if _, ok := received[string(child)]; !ok {
+				pending[string(child)] = struct{}{}
+			}
+		}
+		if err := txn.Put(record.Key, record.Value); err != nil {
+			return err
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("[Trie Import] %d nodes of the root are missing: %w", len(pending), CorruptedNode)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
+	"google.golang.org/protobuf/encoding/protodelim"
+)
+
+// commitCountingKv counts the committed transactions
+type commitCountingKv struct {
+	*MapKv
+	commits int
+}
+
+func (c *commitCountingKv) Transaction() (api.KvStorageTransaction, error) {
+	return &commitCountingKvTransaction{MapKvTransaction{mapkv: c.MapKv}, c}, nil
+}
+
+type commitCountingKvTransaction struct {
+	MapKvTransaction
+	kv *commitCountingKv
+}
+
+func (c *commitCountingKvTransaction) Commit() error {
+	c.kv.commits++
+	return c.MapKvTransaction.Commit()
+}
+
+func TestTrieExportImport(t *testing.T) {
+	keys := randomKeys(200)
+	source := newIteratorTrie(t, keys)
+	var buf bytes.Buffer
+	if err := source.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// import into a trie holding other data
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	target := New(crypto.SHA256.New, kv, []byte("test_root"))
+	target.Put([]byte("old_key"), []byte("old_value"))
+	if err := target.Import(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceRoot, _ := source.RootHash()
+	targetRoot, _ := target.RootHash()
+	if !bytes.Equal(sourceRoot, targetRoot) {
+		t.Fatal("root hash not equal")
+	}
+	it, _ := target.Iterator(nil)
+	got := collect(t, it)
+	if len(got) != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), len(got))
+	}
+	// the replaced root is released
+	checkStoredNodes(t, kv, "test_root")
+}
+
+func TestTrieImportOneTransaction(t *testing.T) {
+	source := newIteratorTrie(t, randomKeys(50))
+	var buf bytes.Buffer
+	if err := source.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// the nodes and the root are committed together, so no prune or crash
+	// sees the imported nodes without their references
+	kv := &commitCountingKv{MapKv: &MapKv{kv: map[string][]byte{}}}
+	target := New(crypto.SHA256.New, kv, []byte("test_root"))
+	if err := target.Import(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if kv.commits != 1 {
+		t.Fatalf("import committed %d transactions", kv.commits)
+	}
+	checkStoredNodes(t, kv.MapKv, "test_root")
+}
+
+func TestTrieImportRejectsCorruption(t *testing.T) {
+	source := newIteratorTrie(t, randomKeys(50))
+	var buf bytes.Buffer
+	if err := source.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	// a node which no node read before refers to
+	var unexpected bytes.Buffer
+	unexpected.Write(data)
+	if _, err := protodelim.MarshalTo(&unexpected, &pb.PersistKV{Key: []byte("key"), Value: []byte("value")}); err != nil {
+		t.Fatal(err)
+	}
+	target := New(crypto.SHA256.New, &MapKv{kv: map[string][]byte{}}, []byte("test_root"))
+	if err := target.Import(&unexpected); !errors.Is(err, CorruptedNode) {
+		t.Fatalf("expected CorruptedNode, got %v", err)
+	}
+	for name, stream := range map[string][]byte{
+		"corrupted": corrupted,
+		"truncated": data[:len(data)/2],
+		"empty":     nil,
+	} {
+		kv := &MapKv{
+			kv: map[string][]byte{},
+		}
+		target := New(crypto.SHA256.New, kv, []byte("test_root"))
+		if err := target.Import(bytes.NewReader(stream)); err == nil {
+			t.Fatalf("%s stream imported", name)
+		}
+		if rootHash, _ := target.RootHash(); rootHash != nil {
+			t.Fatalf("%s stream changed the root", name)
+		}
+	}
+}
+
+func TestTrieExportImportEmpty(t *testing.T) {
+	source := newIteratorTrie(t, nil)
+	var buf bytes.Buffer
+	if err := source.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	target := newIteratorTrie(t, []string{"a"})
+	if err := target.Import(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Get([]byte("a")); err != KeyNotFound {
+		t.Fatal("key found in an empty trie")
+	}
+}
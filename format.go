@@ -0,0 +1,64 @@
+package mpt
+
+import (
+	"fmt"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// format is how the keys and the nodes of a trie are encoded
+type format struct {
+	hFac  HasherFactory
+	codec NodeCodec
+	// keys are split in nibbles and full nodes branch on 16 children
+	hexary bool
+	// values of at most inlineValues bytes are encoded in their parent
+	inlineValues int
+}
+
+func (f format) hasher() *internal.Hasher {
+	return internal.NewHasher(f.hFac(), f.codec.codec(f))
+}
+
+// id identifies the format in kv storage
+func (f format) id() string {
+	id := f.codec.Name()
+	if f.hexary {
+		id += "/hexary"
+	}
+	if f.inlineValues > 0 {
+		id += fmt.Sprintf("/inline=%d", f.inlineValues)
+	}
+	return id
+}
+
+// emptyDeletes reports whether putting an empty value deletes the key,
+// like in Ethereum, as the codec cannot encode empty values
+func (f format) emptyDeletes() bool {
+	return f.codec.Name() == RLPCodec.Name()
+}
+
+// path returns the path of key from the root
+func (f format) path(key []byte) []byte {
+	if !f.hexary || key == nil {
+		return key
+	}
+	path := make([]byte, 2*len(key))
+	for i, b := range key {
+		path[2*i] = b >> 4
+		path[2*i+1] = b & 0x0f
+	}
+	return path
+}
+
+// key returns the key of a path from the root, the path of a key has an even length
+func (f format) key(path []byte) []byte {
+	if !f.hexary || path == nil {
+		return path
+	}
+	key := make([]byte, len(path)/2)
+	for i := range key {
+		key[i] = path[2*i]<<4 | path[2*i+1]
+	}
+	return key
+}
@@ -2,4 +2,9 @@ module github.com/MetaDataLab/go-MerklePatriciaTree
 
 go 1.20
 
-require google.golang.org/protobuf v1.31.0
+require (
+	golang.org/x/crypto v0.17.0
+	google.golang.org/protobuf v1.31.0
+)
+
+require golang.org/x/sys v0.15.0 // indirect
@@ -0,0 +1,207 @@
+package mpt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// RootRecord is an entry of the root history, one is appended by every commit.
+type RootRecord struct {
+	Version  uint64
+	RootHash []byte
+	Metadata []byte
+	// the version restored by Trie.Rollback, zero for a regular commit
+	RollbackTo uint64
+}
+
+// At returns a read-only view of the trie at a previously committed root hash,
+// a nil root hash is the empty trie. The nodes of the root must still be stored,
+// which is guaranteed for every root committed in archive mode.
+func (t *Trie) At(rootHash []byte) (*Trie, error) {
+	view := *t
+	view.readOnly = true
+	view.root = rootHash
+	if len(rootHash) == 0 {
+		return &view, nil
+	}
+	txn, err := t.kv.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Abort()
+	if err := t.checkRoot(txn, rootHash); err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// History returns the committed roots of the trie, oldest first.
+func (t *Trie) History() ([]RootRecord, error) {
+	txn, err := t.kv.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Abort()
+	head, err := historyHead(txn, t.rootKey)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]RootRecord, 0, head)
+	for version := uint64(1); version <= head; version++ {
+		record, err := loadRootRecord(txn, t.rootKey, version)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, RootRecord{
+			Version:    record.Version,
+			RootHash:   record.Root,
+			Metadata:   record.Metadata,
+			RollbackTo: record.RollbackTo,
+		})
+	}
+	return records, nil
+}
+
+// Rollback points the trie back to the root committed at version,
+// and appends the rollback to the root history.
+// The nodes of that root must still be stored, see WithArchive.
+func (t *Trie) Rollback(version uint64) error {
+	if t.readOnly {
+		return ReadOnly
+	}
+	t.writer.Lock()
+	defer t.writer.Unlock()
+	txn, err := t.kv.Transaction()
+	if err != nil {
+		return err
+	}
+	err = t.rollback(txn, version)
+	if err != nil {
+		txn.Abort()
+		return err
+	}
+	return txn.Commit()
+}
+
+func (t *Trie) rollback(txn api.KvStorageTransaction, version uint64) error {
+	record, err := loadRootRecord(txn, t.rootKey, version)
+	if err != nil {
+		return err
+	}
+	if len(record.Root) > 0 {
+		if err := t.checkRoot(txn, record.Root); err != nil {
+			return fmt.Errorf("[Trie History] Cannot rollback to version %d: %w", version, err)
+		}
+	}
+	return t.pointRoot(txn, &pb.PersistRootRecord{
+		Root:       record.Root,
+		RollbackTo: version,
+	})
+}
+
+// pointRoot points the trie to the stored root of record,
+// releases the current root and appends record to the root history.
+func (t *Trie) pointRoot(txn api.KvStorageTransaction, record *pb.PersistRootRecord) error {
+	root, err := t.loadRoot(txn)
+	if err != nil {
+		return err
+	}
+	var oldRoot []byte
+	if root != nil {
+		oldRoot = root.CachedHash()
+	}
+	store := newNodeStore(txn, t.hasher())
+	store.guard = t.guard
+	if len(record.Root) > 0 {
+		if err := store.refHash(record.Root); err != nil {
+			return err
+		}
+	}
+	err = store.replaceRoot(t.rootKey, oldRoot, record.Root, t.archive)
+	if err != nil {
+		return err
+	}
+	err = recordFormat(txn, t.rootKey, t.format)
+	if err != nil {
+		return err
+	}
+	err = appendHistory(txn, t.rootKey, record)
+	if err != nil {
+		return err
+	}
+	return store.flush()
+}
+
+// checkRoot checks that the root node of rootHash is stored
+func (t *Trie) checkRoot(txn api.KvStorageTransaction, rootHash []byte) error {
+	batch := &Batch{kv: txn, format: t.format}
+	hn := internal.HashNode(rootHash)
+	_, err := batch.resolve(&hn, nil)
+	return err
+}
+
+func appendHistory(txn api.KvStorageTransaction, rootKey []byte, record *pb.PersistRootRecord) error {
+	head, err := historyHead(txn, rootKey)
+	if err != nil {
+		return err
+	}
+	record.Version = head + 1
+	data, err := proto.Marshal(record)
+	if err != nil {
+		return err
+	}
+	err = txn.Put(historyKey(rootKey, record.Version), data)
+	if err != nil {
+		return err
+	}
+	return txn.Put(historyKey(rootKey, 0), binary.BigEndian.AppendUint64(nil, record.Version))
+}
+
+func historyHead(txn api.KvStorageTransaction, rootKey []byte) (uint64, error) {
+	data, err := txn.Get(historyKey(rootKey, 0))
+	if err != nil && !errors.Is(err, api.NotFound) {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	if len(data) != 8 {
+		return 0, errors.New("[Trie History] invalid history head")
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func loadRootRecord(txn api.KvStorageTransaction, rootKey []byte, version uint64) (*pb.PersistRootRecord, error) {
+	head, err := historyHead(txn, rootKey)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 || version > head {
+		return nil, fmt.Errorf("[Trie History] version %d: %w", version, UnknownVersion)
+	}
+	data, err := txn.Get(historyKey(rootKey, version))
+	if err != nil {
+		return nil, err
+	}
+	record := &pb.PersistRootRecord{}
+	if err := proto.Unmarshal(data, record); err != nil {
+		return nil, fmt.Errorf("[Trie History] cannot deserialize root record: %w", err)
+	}
+	return record, nil
+}
+
+// historyKey returns the key of a root record, version 0 holds the latest version
+func historyKey(rootKey []byte, version uint64) []byte {
+	key := make([]byte, 0, len(rootKey)+len(historySuffix)+8)
+	key = append(key, rootKey...)
+	key = append(key, historySuffix...)
+	return binary.BigEndian.AppendUint64(key, version)
+}
+
+var historySuffix = []byte("-history-")
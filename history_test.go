@@ -0,0 +1,167 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"testing"
+)
+
+func TestTrieAt(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithArchive())
+	var roots [][]byte
+	for i := 0; i < 5; i++ {
+		batch, _ := trie.Batch(nil)
+		batch.Put([]byte("counter"), []byte(fmt.Sprint(i)))
+		batch.Put([]byte(fmt.Sprint("key", i)), []byte("value"))
+		if i > 0 {
+			batch.Delete([]byte(fmt.Sprint("key", i-1)))
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		rootHash, _ := trie.RootHash()
+		roots = append(roots, rootHash)
+	}
+
+	for i, rootHash := range roots {
+		view, err := trie.At(rootHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := view.Get([]byte("counter"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(val, []byte(fmt.Sprint(i))) {
+			t.Fatalf("version %d: value not equal", i)
+		}
+		if _, err := view.Get([]byte(fmt.Sprint("key", i))); err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 {
+			if _, err := view.Get([]byte(fmt.Sprint("key", i-1))); err != KeyNotFound {
+				t.Fatalf("version %d: deleted key found", i)
+			}
+		}
+		viewRoot, _ := view.RootHash()
+		if !bytes.Equal(viewRoot, rootHash) {
+			t.Fatal("root hash not equal")
+		}
+		if err := view.Put([]byte("counter"), []byte("x")); err != ReadOnly {
+			t.Fatal("view is writable")
+		}
+		if err := view.Delete([]byte("counter")); err != ReadOnly {
+			t.Fatal("view is writable")
+		}
+	}
+
+	// the view does not move with the trie
+	view, _ := trie.At(roots[0])
+	trie.Put([]byte("counter"), []byte("new"))
+	val, _ := view.Get([]byte("counter"))
+	if !bytes.Equal(val, []byte("0")) {
+		t.Fatal("value not equal")
+	}
+}
+
+func TestTrieAtPrunedRoot(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	trie.Put([]byte("key"), []byte("value1"))
+	oldRoot, _ := trie.RootHash()
+	trie.Put([]byte("key"), []byte("value2"))
+
+	if _, err := trie.At(oldRoot); err == nil {
+		t.Fatal("view opened at a deleted root")
+	}
+	newRoot, _ := trie.RootHash()
+	if _, err := trie.At(newRoot); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTrieHistoryRollback(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithArchive())
+	var roots [][]byte
+	for i := 0; i < 4; i++ {
+		batch, _ := trie.Batch(nil)
+		batch.Put([]byte(fmt.Sprint("block", i)), []byte("imported"))
+		if err := batch.CommitWithMetadata([]byte(fmt.Sprint("height ", i))); err != nil {
+			t.Fatal(err)
+		}
+		rootHash, _ := trie.RootHash()
+		roots = append(roots, rootHash)
+	}
+
+	history, err := trie.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(history))
+	}
+	for i, record := range history {
+		if record.Version != uint64(i+1) || !bytes.Equal(record.RootHash, roots[i]) ||
+			!bytes.Equal(record.Metadata, []byte(fmt.Sprint("height ", i))) || record.RollbackTo != 0 {
+			t.Fatalf("unexpected record %+v", record)
+		}
+	}
+
+	// undo the last two blocks
+	if err := trie.Rollback(2); err != nil {
+		t.Fatal(err)
+	}
+	rootHash, _ := trie.RootHash()
+	if !bytes.Equal(rootHash, roots[1]) {
+		t.Fatal("root hash not rolled back")
+	}
+	if _, err := trie.Get([]byte("block2")); err != KeyNotFound {
+		t.Fatal("rolled back key found")
+	}
+	if _, err := trie.Get([]byte("block1")); err != nil {
+		t.Fatal(err)
+	}
+
+	history, _ = trie.History()
+	last := history[len(history)-1]
+	if len(history) != 5 || last.Version != 5 || last.RollbackTo != 2 || !bytes.Equal(last.RootHash, roots[1]) {
+		t.Fatalf("unexpected record %+v", last)
+	}
+
+	// the trie keeps working after the rollback
+	trie.Put([]byte("block2"), []byte("reimported"))
+	val, _ := trie.Get([]byte("block2"))
+	if !bytes.Equal(val, []byte("reimported")) {
+		t.Fatal("value not equal")
+	}
+
+	if err := trie.Rollback(7); err == nil {
+		t.Fatal("rollback to an unknown version")
+	}
+}
+
+func TestTrieRollbackPrunedRoot(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	trie.Put([]byte("key"), []byte("value1"))
+	trie.Put([]byte("key"), []byte("value2"))
+
+	if err := trie.Rollback(1); err == nil {
+		t.Fatal("rollback to a deleted root")
+	}
+	val, _ := trie.Get([]byte("key"))
+	if !bytes.Equal(val, []byte("value2")) {
+		t.Fatal("value not equal")
+	}
+}
@@ -0,0 +1,104 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestTrieInlineValues(t *testing.T) {
+	for _, codec := range []NodeCodec{ProtobufCodec, BinaryCodec} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			build := func(opts ...Option) (*Trie, *MapKv) {
+				kv := &MapKv{kv: map[string][]byte{}}
+				trie := New(crypto.SHA256.New, kv, []byte("test_root"), append(opts, WithNodeCodec(codec))...)
+				batch, _ := trie.Batch(nil)
+				r := rand.New(rand.NewSource(1))
+				for i := 0; i < 200; i++ {
+					// half of the values are small enough to be inlined
+					value := make([]byte, r.Intn(32))
+					r.Read(value)
+					batch.Put([]byte(fmt.Sprintf("key%d", i)), value)
+				}
+				batch.Put([]byte("key"), []byte{})
+				if err := batch.Commit(); err != nil {
+					t.Fatal(err)
+				}
+				return trie, kv
+			}
+			trie, kv := build()
+			inlineTrie, inlineKv := build(WithInlineValues(16))
+			if len(inlineKv.kv) >= len(kv.kv) {
+				t.Fatalf("%d records with inline values, %d without", len(inlineKv.kv), len(kv.kv))
+			}
+
+			root, _ := inlineTrie.RootHash()
+			for i := -1; i < 200; i++ {
+				key := []byte("key")
+				if i >= 0 {
+					key = []byte(fmt.Sprintf("key%d", i))
+				}
+				want, _ := trie.Get(key)
+				got, err := inlineTrie.Get(key)
+				if err != nil || !bytes.Equal(got, want) {
+					t.Fatalf("get %s: %x %v, want %x", key, got, err, want)
+				}
+				proof, err := inlineTrie.Prove(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err = VerifyProof(crypto.SHA256.New, root, key, proof, WithNodeCodec(codec))
+				if err != nil || !bytes.Equal(got, want) {
+					t.Fatalf("verify %s: %x %v, want %x", key, got, err, want)
+				}
+			}
+			// the stored nodes are decoded as protobuf nodes
+			if codec.Name() == ProtobufCodec.Name() {
+				checkStoredNodes(t, inlineKv, "test_root")
+			}
+
+			// values move in and out of their parent as they change
+			batch, _ := inlineTrie.Batch(nil)
+			for i := 0; i < 200; i += 2 {
+				batch.Put([]byte(fmt.Sprintf("key%d", i)), bytes.Repeat([]byte{byte(i)}, 40-i%40))
+			}
+			if err := batch.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			if codec.Name() == ProtobufCodec.Name() {
+				checkStoredNodes(t, inlineKv, "test_root")
+			}
+			batch, _ = inlineTrie.Batch(nil)
+			for i := -1; i < 200; i++ {
+				key := []byte("key")
+				if i >= 0 {
+					key = []byte(fmt.Sprintf("key%d", i))
+				}
+				if err := batch.Delete(key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := batch.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			checkStoredNodes(t, inlineKv, "test_root")
+		})
+	}
+}
+
+func TestTrieInlineValuesRecorded(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithInlineValues(16))
+	if err := trie.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range [][]Option{nil, {WithInlineValues(32)}} {
+		other := New(crypto.SHA256.New, kv, []byte("test_root"), opts...)
+		if _, err := other.Get([]byte("key")); !errors.Is(err, CodecMismatch) {
+			t.Fatalf("expected CodecMismatch, got %v", err)
+		}
+	}
+}
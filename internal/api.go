@@ -2,17 +2,16 @@ package internal
 
 import (
 	"fmt"
-	"hash"
-
-	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
 )
 
 type (
 	Node interface {
-		Hash(hash.Hash) []byte
+		// Hash returns the reference of the node in its parent, serializing it if it is dirty
+		Hash(*Hasher) []byte
+		// CachedHash returns the reference computed by the last serialization,
+		// or the hash the node was loaded from
 		CachedHash() []byte
-		Serialize(hash.Hash) ([]byte, error)
-		Save(api.KvStorageTransaction, hash.Hash) error
+		Serialize(*Hasher) ([]byte, error)
 	}
 
 	NodeStatus uint8
@@ -21,15 +20,12 @@ type (
 const (
 	CLEAN NodeStatus = iota
 	DIRTY
-	DELETED
 )
 
 func (s NodeStatus) String() string {
 	switch s {
 	case CLEAN:
 		return "CLEAN"
-	case DELETED:
-		return "DELETED"
 	case DIRTY:
 		return "DIRTY"
 	default:
@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	binaryFull byte = iota
+	binaryShort
+	binaryValue
+	// a short node followed by its value instead of the hash of a value node
+	binaryShortInline
+)
+
+// BinaryCodec encodes nodes in a compact format made of a tag byte and uvarint lengths:
+// a full node is the list of its children as slot and length-prefixed hash,
+// a short node is its length-prefixed key followed by the hash of its child,
+// and a value node is its value. Every child is stored under its own hash,
+// except the values of at most InlineValues bytes when InlineValues is positive.
+// The slot of a full node child is shifted left by one, the low bit marks an inline value.
+type BinaryCodec struct {
+	InlineValues int
+}
+
+func (c BinaryCodec) Encode(n Node, h *Hasher) ([]byte, error) {
+	switch n := n.(type) {
+	case *FullNode:
+		data := []byte{binaryFull}
+		for i, child := range n.Children {
+			if child == nil {
+				continue
+			}
+			if c.InParent(n, i, child) {
+				value := child.(*ValueNode).Value
+				data = binary.AppendUvarint(data, uint64(i)<<1|1)
+				data = binary.AppendUvarint(data, uint64(len(value)))
+				data = append(data, value...)
+				continue
+			}
+			ref, err := h.Ref(child)
+			if err != nil {
+				return nil, err
+			}
+			data = binary.AppendUvarint(data, uint64(i)<<1)
+			data = binary.AppendUvarint(data, uint64(len(ref)))
+			data = append(data, ref...)
+		}
+		return data, nil
+	case *ShortNode:
+		if c.InParent(n, 0, n.Value) {
+			data := []byte{binaryShortInline}
+			data = binary.AppendUvarint(data, uint64(len(n.Key)))
+			data = append(data, n.Key...)
+			return append(data, n.Value.(*ValueNode).Value...), nil
+		}
+		ref, err := h.Ref(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		data := []byte{binaryShort}
+		data = binary.AppendUvarint(data, uint64(len(n.Key)))
+		data = append(data, n.Key...)
+		return append(data, ref...), nil
+	case *ValueNode:
+		return append([]byte{binaryValue}, n.Value...), nil
+	}
+	return nil, errors.New("[Node] Unknown node type")
+}
+
+func (c BinaryCodec) Decode(data []byte, h *Hasher) (Node, error) {
+	if len(data) == 0 {
+		return nil, errors.New("[Node] cannot deserialize an empty node")
+	}
+	// the decoded nodes keep slices of data
+	data = append([]byte{}, data...)
+	tag, data := data[0], data[1:]
+	switch tag {
+	case binaryFull:
+		fullNode := FullNode{}
+		last := -1
+		for len(data) > 0 {
+			entry, n := binary.Uvarint(data)
+			slot, inline := entry>>1, entry&1 == 1
+			if n <= 0 || slot >= uint64(len(fullNode.Children)) || int(slot) <= last {
+				return nil, errors.New("[Node] invalid full node slot")
+			}
+			ref, rest, err := binaryBytes(data[n:])
+			if err != nil {
+				return nil, err
+			}
+			if inline {
+				fullNode.Children[slot] = &ValueNode{Value: ref}
+			} else if len(ref) == 0 {
+				return nil, fmt.Errorf("[Node] empty reference of full node child %d", slot)
+			} else {
+				child := HashNode(ref)
+				fullNode.Children[slot] = &child
+			}
+			last, data = int(slot), rest
+		}
+		return &fullNode, nil
+	case binaryShort:
+		key, ref, err := binaryBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(ref) == 0 {
+			return nil, errors.New("[Node] nil short node value")
+		}
+		child := HashNode(ref)
+		return &ShortNode{Key: key, Value: &child}, nil
+	case binaryShortInline:
+		key, value, err := binaryBytes(data)
+		if err != nil {
+			return nil, err
+		}
+		return &ShortNode{Key: key, Value: &ValueNode{Value: value}}, nil
+	case binaryValue:
+		return &ValueNode{Value: data}, nil
+	}
+	return nil, fmt.Errorf("[Node] Unknown node tag %d", tag)
+}
+
+// binaryBytes splits a uvarint length-prefixed byte string from data
+func binaryBytes(data []byte) ([]byte, []byte, error) {
+	size, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < size {
+		return nil, nil, errors.New("[Node] truncated node")
+	}
+	end := n + int(size)
+	return data[n:end], data[end:], nil
+}
+
+func (BinaryCodec) Embeds([]byte) bool { return false }
+
+func (c BinaryCodec) InParent(_ Node, _ int, child Node) bool {
+	return inlineValue(c.InlineValues, child)
+}
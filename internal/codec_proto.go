@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoCodec encodes nodes as PersistNode protobuf messages,
+// every child is stored under its own hash except the values of at most InlineValues bytes,
+// which are encoded in their parent when InlineValues is positive.
+// Full nodes are encoded as PersistSparseFullNode, the older PersistFullNode is still decoded.
+type ProtoCodec struct {
+	InlineValues int
+}
+
+func (c ProtoCodec) Encode(n Node, h *Hasher) ([]byte, error) {
+	persistNode := &pb.PersistNode{}
+	switch n := n.(type) {
+	case *FullNode:
+		persistFullNode := pb.PersistSparseFullNode{}
+		persistFullNode.Bitmap = make([]byte, (len(n.Children)+7)/8)
+		for i := 0; i < len(n.Children); i++ {
+			if n.Children[i] == nil {
+				continue
+			}
+			persistFullNode.Bitmap[i/8] |= 1 << (i % 8)
+			if c.InParent(n, i, n.Children[i]) {
+				if persistFullNode.Inline == nil {
+					persistFullNode.Inline = make([]byte, len(persistFullNode.Bitmap))
+				}
+				persistFullNode.Inline[i/8] |= 1 << (i % 8)
+				persistFullNode.Children = append(persistFullNode.Children, n.Children[i].(*ValueNode).Value)
+				continue
+			}
+			ref, err := h.Ref(n.Children[i])
+			if err != nil {
+				return nil, err
+			}
+			persistFullNode.Children = append(persistFullNode.Children, ref)
+		}
+		persistNode.Content = &pb.PersistNode_Sparse{Sparse: &persistFullNode}
+	case *ShortNode:
+		persistShortNode := pb.PersistShortNode{}
+		persistShortNode.Key = n.Key
+		if c.InParent(n, 0, n.Value) {
+			persistShortNode.Value = n.Value.(*ValueNode).Value
+			persistShortNode.Inline = true
+		} else {
+			ref, err := h.Ref(n.Value)
+			if err != nil {
+				return nil, err
+			}
+			persistShortNode.Value = ref
+		}
+		persistNode.Content = &pb.PersistNode_Short{Short: &persistShortNode}
+	case *ValueNode:
+		persistNode.Content = &pb.PersistNode_Value{Value: n.Value}
+	default:
+		return nil, errors.New("[Node] Unknown node type")
+	}
+	return proto.Marshal(persistNode)
+}
+
+func (c ProtoCodec) Decode(data []byte, h *Hasher) (Node, error) {
+	persistNode := &pb.PersistNode{}
+	err := proto.Unmarshal(data, persistNode)
+	if err != nil {
+		return nil, fmt.Errorf("[Node] cannot deserialize persist node: %w", err)
+	}
+	switch v := persistNode.Content.(type) {
+	case *pb.PersistNode_Full:
+		fullNode := FullNode{}
+		if len(v.Full.Children) != len(fullNode.Children) {
+			return nil, errors.New("[Node] invalid full node children count")
+		}
+		for i := 0; i < len(fullNode.Children); i++ {
+			if len(v.Full.Children[i]) != 0 {
+				child := HashNode(v.Full.Children[i])
+				fullNode.Children[i] = &child
+			}
+		}
+		return &fullNode, nil
+	case *pb.PersistNode_Sparse:
+		fullNode := FullNode{}
+		if len(v.Sparse.Bitmap) != (len(fullNode.Children)+7)/8 {
+			return nil, errors.New("[Node] invalid full node bitmap")
+		}
+		if len(v.Sparse.Inline) != 0 && len(v.Sparse.Inline) != len(v.Sparse.Bitmap) {
+			return nil, errors.New("[Node] invalid full node inline bitmap")
+		}
+		next := 0
+		for i := 0; i < len(fullNode.Children); i++ {
+			inline := len(v.Sparse.Inline) != 0 && v.Sparse.Inline[i/8]&(1<<(i%8)) != 0
+			if v.Sparse.Bitmap[i/8]&(1<<(i%8)) == 0 {
+				if inline {
+					return nil, errors.New("[Node] invalid full node inline bitmap")
+				}
+				continue
+			}
+			if next == len(v.Sparse.Children) {
+				return nil, errors.New("[Node] missing full node child")
+			}
+			if inline {
+				fullNode.Children[i] = &ValueNode{Value: v.Sparse.Children[next]}
+			} else if len(v.Sparse.Children[next]) == 0 {
+				return nil, errors.New("[Node] missing full node child")
+			} else {
+				child := HashNode(v.Sparse.Children[next])
+				fullNode.Children[i] = &child
+			}
+			next++
+		}
+		if next != len(v.Sparse.Children) || v.Sparse.Bitmap[len(v.Sparse.Bitmap)-1]>>(len(fullNode.Children)%8) != 0 {
+			return nil, errors.New("[Node] invalid full node children count")
+		}
+		return &fullNode, nil
+	case *pb.PersistNode_Short:
+		shortNode := ShortNode{}
+		shortNode.Key = v.Short.Key
+		if v.Short.Inline {
+			shortNode.Value = &ValueNode{Value: v.Short.Value}
+			return &shortNode, nil
+		}
+		if len(v.Short.Value) == 0 {
+			return nil, errors.New("[Node] nil short node value")
+		}
+		child := HashNode(v.Short.Value)
+		shortNode.Value = &child
+		return &shortNode, nil
+	case *pb.PersistNode_Value:
+		return &ValueNode{Value: v.Value}, nil
+	}
+	return nil, errors.New("[Node] Unknown node type")
+}
+
+func (ProtoCodec) Embeds([]byte) bool { return false }
+
+func (c ProtoCodec) InParent(_ Node, _ int, child Node) bool {
+	return inlineValue(c.InlineValues, child)
+}
+
+// inlineValue reports whether child is a value of at most limit bytes, limit 0 disables inlining
+func inlineValue(limit int, child Node) bool {
+	vn, ok := child.(*ValueNode)
+	return ok && limit > 0 && len(vn.Value) <= limit
+}
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RLPCodec encodes nodes like Ethereum does when Hexary is set:
+// a short node is [hex prefix key, child], a full node is [16 children, value],
+// a value is part of its short node or in the last item of its full node,
+// and a node whose encoding is shorter than 32 bytes is embedded in its parent.
+// Otherwise a full node has 256 children and a short node key is a flag byte followed by the key.
+type RLPCodec struct {
+	Hexary bool
+}
+
+func (c RLPCodec) width() int {
+	if c.Hexary {
+		return 16
+	}
+	return 256
+}
+
+func (c RLPCodec) Encode(n Node, h *Hasher) ([]byte, error) {
+	var payload []byte
+	switch n := n.(type) {
+	case *FullNode:
+		for i := 0; i < c.width(); i++ {
+			var err error
+			payload, err = rlpRef(payload, n.Children[i], h)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i := c.width(); i < 256; i++ {
+			if n.Children[i] != nil {
+				return nil, fmt.Errorf("[Node] cannot encode child %d of a full node of %d children", i, c.width())
+			}
+		}
+		switch v := n.Children[256].(type) {
+		case nil:
+			payload = rlpString(payload, nil)
+		case *ValueNode:
+			if len(v.Value) == 0 {
+				return nil, errors.New("[Node] cannot encode an empty value")
+			}
+			payload = rlpString(payload, v.Value)
+		default:
+			return nil, errors.New("[Node] unexpected node in value slot")
+		}
+	case *ShortNode:
+		if v, ok := n.Value.(*ValueNode); ok {
+			if len(v.Value) == 0 {
+				return nil, errors.New("[Node] cannot encode an empty value")
+			}
+			payload = rlpString(payload, c.encodeKey(n.Key, true))
+			payload = rlpString(payload, v.Value)
+			break
+		}
+		if len(n.Key) == 0 {
+			return nil, errors.New("[Node] cannot encode a short node with an empty key")
+		}
+		payload = rlpString(payload, c.encodeKey(n.Key, false))
+		var err error
+		payload, err = rlpRef(payload, n.Value, h)
+		if err != nil {
+			return nil, err
+		}
+	case *ValueNode:
+		// a value out of a short node or a value slot is a leaf with an empty key
+		if len(n.Value) == 0 {
+			return nil, errors.New("[Node] cannot encode an empty value")
+		}
+		payload = rlpString(payload, c.encodeKey(nil, true))
+		payload = rlpString(payload, n.Value)
+	default:
+		return nil, errors.New("[Node] Unknown node type")
+	}
+	return rlpList(nil, payload), nil
+}
+
+// encodeKey encodes the key of a short node with the leaf flag
+func (c RLPCodec) encodeKey(key []byte, leaf bool) []byte {
+	if c.Hexary {
+		return hexPrefix(key, leaf)
+	}
+	var flag byte
+	if leaf {
+		flag = 0x20
+	}
+	return append([]byte{flag}, key...)
+}
+
+func (c RLPCodec) decodeKey(data []byte) ([]byte, bool, error) {
+	if c.Hexary {
+		return hexPrefixDecode(data)
+	}
+	if len(data) == 0 || (data[0] != 0 && data[0] != 0x20) {
+		return nil, false, errors.New("[RLP] invalid key flag")
+	}
+	return data[1:], data[0] == 0x20, nil
+}
+
+// rlpRef appends the reference of child to buf, an embedded child is appended as is
+func rlpRef(buf []byte, child Node, h *Hasher) ([]byte, error) {
+	if child == nil {
+		return rlpString(buf, nil), nil
+	}
+	ref, err := h.Ref(child)
+	if err != nil {
+		return nil, err
+	}
+	if h.Embedded(ref) {
+		return append(buf, ref...), nil
+	}
+	return rlpString(buf, ref), nil
+}
+
+func (c RLPCodec) Decode(data []byte, h *Hasher) (Node, error) {
+	// the decoded nodes keep slices of data
+	data = append([]byte{}, data...)
+	node, err := c.decodeNode(data, h)
+	if err != nil {
+		return nil, fmt.Errorf("[Node] cannot deserialize rlp node: %w", err)
+	}
+	return node, nil
+}
+
+func (c RLPCodec) decodeNode(data []byte, h *Hasher) (Node, error) {
+	isList, content, _, rest, err := rlpSplit(data)
+	if err != nil {
+		return nil, err
+	}
+	if !isList || len(rest) != 0 {
+		return nil, errRLP
+	}
+	items, err := rlpItems(content)
+	if err != nil {
+		return nil, err
+	}
+	switch len(items) {
+	case 2:
+		encodedKey, err := rlpContent(items[0])
+		if err != nil {
+			return nil, err
+		}
+		key, leaf, err := c.decodeKey(encodedKey)
+		if err != nil {
+			return nil, err
+		}
+		if leaf {
+			value, err := rlpContent(items[1])
+			if err != nil {
+				return nil, err
+			}
+			if len(value) == 0 {
+				return nil, errors.New("empty value")
+			}
+			if len(key) == 0 {
+				return &ValueNode{Value: value}, nil
+			}
+			return &ShortNode{Key: key, Value: &ValueNode{Value: value}}, nil
+		}
+		if len(key) == 0 {
+			return nil, errors.New("empty short node key")
+		}
+		child, err := c.decodeRef(items[1], h)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			return nil, errors.New("nil short node value")
+		}
+		return &ShortNode{Key: key, Value: child}, nil
+	case c.width() + 1:
+		fullNode := &FullNode{}
+		for i := 0; i < c.width(); i++ {
+			child, err := c.decodeRef(items[i], h)
+			if err != nil {
+				return nil, err
+			}
+			fullNode.Children[i] = child
+		}
+		value, err := rlpContent(items[c.width()])
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > 0 {
+			fullNode.Children[256] = &ValueNode{Value: value}
+		}
+		return fullNode, nil
+	}
+	return nil, fmt.Errorf("unexpected list of %d items", len(items))
+}
+
+// decodeRef decodes the reference to a child, an embedded child is decoded
+func (c RLPCodec) decodeRef(item []byte, h *Hasher) (Node, error) {
+	isList, content, _, _, err := rlpSplit(item)
+	if err != nil {
+		return nil, err
+	}
+	if isList {
+		child, err := c.decodeNode(item, h)
+		if err != nil {
+			return nil, err
+		}
+		// an embedded node is referred by its encoding
+		switch n := child.(type) {
+		case *FullNode:
+			n.Cache = item
+		case *ShortNode:
+			n.Cache = item
+		case *ValueNode:
+			n.Cache = item
+		}
+		return child, nil
+	}
+	switch len(content) {
+	case 0:
+		return nil, nil
+	case h.Size():
+		hn := HashNode(content)
+		return &hn, nil
+	}
+	return nil, fmt.Errorf("invalid child reference of %d bytes", len(content))
+}
+
+// rlpContent returns the content of a string item
+func rlpContent(item []byte) ([]byte, error) {
+	isList, content, _, _, err := rlpSplit(item)
+	if err != nil {
+		return nil, err
+	}
+	if isList {
+		return nil, errRLP
+	}
+	return content, nil
+}
+
+func (RLPCodec) Embeds(data []byte) bool { return len(data) < 32 }
+
+func (RLPCodec) InParent(parent Node, slot int, child Node) bool {
+	if _, ok := child.(*ValueNode); !ok {
+		return false
+	}
+	switch parent.(type) {
+	case *ShortNode:
+		return true
+	case *FullNode:
+		return slot == 256
+	}
+	return false
+}
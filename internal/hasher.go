@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"hash"
+)
+
+// Codec encodes the nodes of a trie for storage and hashing
+type Codec interface {
+	// Encode returns the encoding of n, its children are referred by Hasher.Ref
+	Encode(n Node, h *Hasher) ([]byte, error)
+	// Decode decodes a node, the children referred by their hash are hash nodes
+	// and the embedded children are decoded along with it
+	Decode(data []byte, h *Hasher) (Node, error)
+	// Embeds reports whether a node of encoding data is embedded in its parent
+	// instead of being stored under its hash, it must be shorter than the hash
+	Embeds(data []byte) bool
+	// InParent reports whether child, at slot of parent, is encoded as a part of parent
+	// and has no reference of its own, slot is 0 for the child of a short node
+	InParent(parent Node, slot int, child Node) bool
+}
+
+// Hasher hashes nodes encoded by its codec
+type Hasher struct {
+	hash.Hash
+	Codec Codec
+}
+
+func NewHasher(h hash.Hash, codec Codec) *Hasher {
+	return &Hasher{Hash: h, Codec: codec}
+}
+
+// ref returns the reference of a node of encoding data in its parent
+func (h *Hasher) ref(data []byte) ([]byte, error) {
+	if h.Codec.Embeds(data) {
+		return data, nil
+	}
+	return Hash(h, data)
+}
+
+// Ref returns the reference of n in its parent, serializing n if needed
+func (h *Hasher) Ref(n Node) ([]byte, error) {
+	if _, ok := n.(*HashNode); !ok && (n.CachedHash() == nil || IsDirty(n)) {
+		if _, err := n.Serialize(h); err != nil {
+			return nil, err
+		}
+	}
+	return n.CachedHash(), nil
+}
+
+// Embedded reports whether ref is the encoding of an embedded node rather than a hash
+func (h *Hasher) Embedded(ref []byte) bool {
+	return len(ref) < h.Size()
+}
+
+// Stored reports whether child, at slot of parent, is stored under its own hash
+func (h *Hasher) Stored(parent Node, slot int, child Node) (bool, error) {
+	if _, ok := child.(*HashNode); ok {
+		return true, nil
+	}
+	if h.Codec.InParent(parent, slot, child) {
+		return false, nil
+	}
+	ref, err := h.Ref(child)
+	if err != nil {
+		return false, err
+	}
+	return !h.Embedded(ref), nil
+}
+
+// StoredChildren calls fn for the children of n stored under their own hash,
+// the children embedded in the encoding of n are walked through
+func (h *Hasher) StoredChildren(n Node, fn func(Node) error) error {
+	visit := func(slot int, child Node) error {
+		if child == nil {
+			return nil
+		}
+		stored, err := h.Stored(n, slot, child)
+		if err != nil {
+			return err
+		}
+		if stored {
+			return fn(child)
+		}
+		return h.StoredChildren(child, fn)
+	}
+	switch n := n.(type) {
+	case *FullNode:
+		for i, child := range n.Children {
+			if err := visit(i, child); err != nil {
+				return err
+			}
+		}
+	case *ShortNode:
+		return visit(0, n.Value)
+	}
+	return nil
+}
+
+// IsDirty reports whether n changed since it was loaded or serialized
+func IsDirty(n Node) bool {
+	switch n := n.(type) {
+	case *FullNode:
+		return n.Status == DIRTY
+	case *ShortNode:
+		return n.Status == DIRTY
+	case *ValueNode:
+		return n.Status == DIRTY
+	}
+	return false
+}
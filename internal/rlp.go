@@ -0,0 +1,137 @@
+package internal
+
+import (
+	"errors"
+)
+
+// minimal RLP, see the appendix B of the Ethereum yellow paper
+
+var errRLP = errors.New("[RLP] invalid encoding")
+
+// rlpString appends the encoding of the byte string s to buf
+func rlpString(buf, s []byte) []byte {
+	if len(s) == 1 && s[0] < 0x80 {
+		return append(buf, s[0])
+	}
+	buf = rlpHeader(buf, 0x80, len(s))
+	return append(buf, s...)
+}
+
+// rlpList appends the encoding of a list made of the encoded items payload to buf
+func rlpList(buf, payload []byte) []byte {
+	buf = rlpHeader(buf, 0xc0, len(payload))
+	return append(buf, payload...)
+}
+
+func rlpHeader(buf []byte, offset byte, size int) []byte {
+	if size <= 55 {
+		return append(buf, offset+byte(size))
+	}
+	var sizeBytes []byte
+	for s := size; s > 0; s >>= 8 {
+		sizeBytes = append([]byte{byte(s)}, sizeBytes...)
+	}
+	buf = append(buf, offset+55+byte(len(sizeBytes)))
+	return append(buf, sizeBytes...)
+}
+
+// rlpSplit splits the first item of data, it returns whether the item is a list,
+// its content, its whole encoding and the bytes after it
+func rlpSplit(data []byte) (isList bool, content, item, rest []byte, err error) {
+	if len(data) == 0 {
+		return false, nil, nil, nil, errRLP
+	}
+	b := data[0]
+	var offset, size int
+	switch {
+	case b < 0x80:
+		return false, data[:1], data[:1], data[1:], nil
+	case b <= 0xb7:
+		offset, size = 1, int(b-0x80)
+		if size == 1 && len(data) > 1 && data[1] < 0x80 {
+			// a single byte below 0x80 is its own encoding
+			return false, nil, nil, nil, errRLP
+		}
+	case b < 0xc0:
+		offset, size, err = rlpLongSize(data, int(b-0xb7))
+	case b <= 0xf7:
+		isList = true
+		offset, size = 1, int(b-0xc0)
+	default:
+		isList = true
+		offset, size, err = rlpLongSize(data, int(b-0xf7))
+	}
+	if err != nil {
+		return false, nil, nil, nil, err
+	}
+	if len(data)-offset < size {
+		return false, nil, nil, nil, errRLP
+	}
+	end := offset + size
+	return isList, data[offset:end], data[:end], data[end:], nil
+}
+
+func rlpLongSize(data []byte, sizeLen int) (int, int, error) {
+	if len(data) < 1+sizeLen || sizeLen > 4 || data[1] == 0 {
+		return 0, 0, errRLP
+	}
+	size := 0
+	for _, b := range data[1 : 1+sizeLen] {
+		size = size<<8 | int(b)
+	}
+	if size <= 55 {
+		return 0, 0, errRLP
+	}
+	return 1 + sizeLen, size, nil
+}
+
+// rlpItems splits the content of a list in the encodings of its items
+func rlpItems(content []byte) ([][]byte, error) {
+	var items [][]byte
+	for len(content) > 0 {
+		_, _, item, rest, err := rlpSplit(content)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+		content = rest
+	}
+	return items, nil
+}
+
+// hexPrefix encodes a nibble path with the leaf flag, two nibbles per byte
+func hexPrefix(path []byte, leaf bool) []byte {
+	var flag byte
+	if leaf {
+		flag = 2
+	}
+	ret := make([]byte, 0, len(path)/2+1)
+	if len(path)%2 == 1 {
+		ret = append(ret, (flag+1)<<4|path[0])
+		path = path[1:]
+	} else {
+		ret = append(ret, flag<<4)
+	}
+	for i := 0; i < len(path); i += 2 {
+		ret = append(ret, path[i]<<4|path[i+1])
+	}
+	return ret
+}
+
+// hexPrefixDecode decodes a path encoded by hexPrefix
+func hexPrefixDecode(data []byte) ([]byte, bool, error) {
+	if len(data) == 0 || data[0]>>4 > 3 {
+		return nil, false, errors.New("[RLP] invalid hex prefix")
+	}
+	flag := data[0] >> 4
+	path := make([]byte, 0, 2*len(data))
+	if flag&1 == 1 {
+		path = append(path, data[0]&0x0f)
+	} else if data[0]&0x0f != 0 {
+		return nil, false, errors.New("[RLP] invalid hex prefix")
+	}
+	for _, b := range data[1:] {
+		path = append(path, b>>4, b&0x0f)
+	}
+	return path, flag&2 == 2, nil
+}
@@ -1,12 +1,7 @@
 package internal
 
 import (
-	"errors"
-	fmt "fmt"
 	"hash"
-
-	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
-	"google.golang.org/protobuf/proto"
 )
 
 func Hash(hasher hash.Hash, data []byte) ([]byte, error) {
@@ -18,57 +13,45 @@ func Hash(hasher hash.Hash, data []byte) ([]byte, error) {
 	return hasher.Sum(nil), nil
 }
 
-func DeserializeNode(hasher hash.Hash, data []byte) (Node, error) {
-	persistNode := &pb.PersistNode{}
-	err := proto.Unmarshal(data, persistNode)
+// DeserializeNode decodes a node stored under its hash
+func DeserializeNode(hasher *Hasher, data []byte) (Node, error) {
+	node, err := hasher.Codec.Decode(data, hasher)
 	if err != nil {
-		return nil, fmt.Errorf("[Node] cannot deserialize persist node: %s", err.Error())
+		return nil, err
 	}
-	switch v := persistNode.Content.(type) {
-	case *pb.PersistNode_Full:
-		fullNode := FullNode{}
-		for i := 0; i < len(fullNode.Children); i++ {
-			if len(v.Full.Children[i]) != 0 {
-				child := HashNode(v.Full.Children[i])
-				fullNode.Children[i] = &child
-				if len([]byte(child)) == 0 {
-					return nil, errors.New("[Node] nil full node child")
-				}
-			}
-		}
-		hash, err := Hash(hasher, data)
-		if err != nil {
-			return nil, err
-		}
-		originalKey := make([]byte, len(hash))
-		fullNode.OriginalKey = originalKey
-		fullNode.Cache = hash[:]
-		return &fullNode, nil
-	case *pb.PersistNode_Short:
-		shortNode := ShortNode{}
-		shortNode.Key = v.Short.Key
-		if len(v.Short.Value) == 0 {
-			return nil, errors.New("[Node] nil short node value")
-		}
-		child := HashNode(v.Short.Value)
-		shortNode.Value = &child
-		hash, err := Hash(hasher, data)
-		if err != nil {
-			return nil, err
-		}
-		originalKey := make([]byte, len(hash))
-		shortNode.OriginalKey = originalKey
-		shortNode.Cache = hash[:]
-		return &shortNode, nil
-	case *pb.PersistNode_Value:
-		hash, err := Hash(hasher, data)
-		if err != nil {
-			return nil, err
+	// a stored node is referred by its hash, even when small enough to be embedded
+	hash, err := Hash(hasher, data)
+	if err != nil {
+		return nil, err
+	}
+	switch n := node.(type) {
+	case *FullNode:
+		n.Cache = hash
+	case *ShortNode:
+		n.Cache = hash
+	case *ValueNode:
+		n.Cache = hash
+	}
+	return node, nil
+}
+
+// CopyNode copies a decoded node and its embedded children,
+// so the copy can be changed without changing node. Hash nodes and values are shared.
+func CopyNode(node Node) Node {
+	switch n := node.(type) {
+	case *FullNode:
+		c := *n
+		for i, child := range c.Children {
+			c.Children[i] = CopyNode(child)
 		}
-		originalKey := make([]byte, len(hash))
-		copy(originalKey, hash)
-		ret := ValueNode{originalKey, v.Value, hash[:], CLEAN}
-		return &ret, nil
+		return &c
+	case *ShortNode:
+		c := *n
+		c.Value = CopyNode(c.Value)
+		return &c
+	case *ValueNode:
+		c := *n
+		return &c
 	}
-	return nil, errors.New("[Node] Unknown node type")
+	return node
 }
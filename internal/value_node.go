@@ -1,49 +1,29 @@
 package internal
 
-import (
-	"hash"
-
-	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
-	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
-	"google.golang.org/protobuf/proto"
-)
-
 type ValueNode struct {
-	OriginalKey []byte
-	Value       []byte
-	Cache       []byte
-	Status      NodeStatus
+	Value  []byte
+	Cache  []byte
+	Status NodeStatus
 }
 
 func (n *ValueNode) CachedHash() []byte { return n.Cache }
 
-func (vn *ValueNode) Serialize(hasher hash.Hash) ([]byte, error) {
-	persistValueNode := pb.PersistNode_Value{}
-	persistValueNode.Value = vn.Value
-	persistNode := pb.PersistNode{
-		Content: &persistValueNode,
+func (vn *ValueNode) Serialize(hasher *Hasher) ([]byte, error) {
+	data, err := hasher.Codec.Encode(vn, hasher)
+	if err != nil {
+		return nil, err
 	}
-	data, _ := proto.Marshal(&persistNode)
-	hash, err := Hash(hasher, data)
+	vn.Cache, err = hasher.ref(data)
 	if err != nil {
 		return nil, err
 	}
-	vn.Cache = hash[:]
 	vn.Status = CLEAN
 	return data, nil
 }
 
-func (vn *ValueNode) Hash(cs hash.Hash) []byte {
+func (vn *ValueNode) Hash(hasher *Hasher) []byte {
 	if vn.Status == DIRTY {
-		vn.Serialize(cs)
+		vn.Serialize(hasher)
 	}
 	return vn.Cache
 }
-
-func (vn *ValueNode) Save(kv api.KvStorageTransaction, cs hash.Hash) error {
-	data, err := vn.Serialize(cs)
-	if err != nil {
-		return err
-	}
-	return kv.Put(vn.Cache, data)
-}
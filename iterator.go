@@ -0,0 +1,185 @@
+package mpt
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// Iterator walks the key/value pairs of a trie in lexicographic key order,
+// or in reverse order, within a range of keys.
+// Hash nodes are loaded from kv storage only when the walk reaches them,
+// the batch being iterated should not be modified until the iterator is closed.
+type Iterator struct {
+	batch   *Batch
+	owned   bool
+	lower   []byte
+	upper   []byte
+	reverse bool
+	stack   []*iteratorFrame
+	key     []byte
+	value   []byte
+	err     error
+}
+
+type iteratorFrame struct {
+	node internal.Node
+	path []byte
+	// next position to visit in the children of a full node,
+	// position 0 is the value slot 256 as it holds the shortest key
+	next int
+}
+
+// newIterator creates an iterator over the keys in [lower, upper),
+// a nil upper bound means no upper bound
+func newIterator(b *Batch, lower, upper []byte, reverse bool) *Iterator {
+	it := &Iterator{
+		batch:   b,
+		lower:   b.path(lower),
+		upper:   b.path(upper),
+		reverse: reverse,
+	}
+	if b.closed {
+		it.err = BatchClosed
+		return it
+	}
+	if b.root != nil {
+		it.push(b.root, nil)
+	}
+	return it
+}
+
+// Iterator returns an iterator over the keys greater than or equal to start,
+// including the uncommitted changes of the batch.
+func (b *Batch) Iterator(start []byte) *Iterator {
+	return newIterator(b, start, nil, false)
+}
+
+// Range returns an iterator over the keys in [from, to), a nil to means no upper bound.
+// Subtrees outside of the range are skipped without being loaded.
+func (b *Batch) Range(from, to []byte, reverse bool) *Iterator {
+	return newIterator(b, from, to, reverse)
+}
+
+// ScanPrefix returns an iterator over the keys starting with prefix,
+// only the nodes on the path to the prefix and below it are loaded.
+func (b *Batch) ScanPrefix(prefix []byte, reverse bool) *Iterator {
+	return newIterator(b, prefix, prefixEnd(prefix), reverse)
+}
+
+// Next moves the iterator to the next key/value pair,
+// it returns false when the iteration is done or an error occurs.
+func (it *Iterator) Next() bool {
+	it.key, it.value = nil, nil
+	for it.err == nil && len(it.stack) > 0 {
+		top := it.stack[len(it.stack)-1]
+		switch n := top.node.(type) {
+		case *internal.HashNode:
+			loadedNode, err := it.batch.resolve(n, top.path)
+			if err != nil {
+				it.err = err
+				return false
+			}
+			top.node = loadedNode
+		case *internal.FullNode:
+			if top.next < 0 || top.next > 256 {
+				it.pop()
+				continue
+			}
+			slot := top.next - 1
+			path := top.path
+			if top.next == 0 {
+				slot = 256
+			} else {
+				path = appendPath(top.path, byte(slot))
+			}
+			if it.reverse {
+				top.next--
+			} else {
+				top.next++
+			}
+			if n.Children[slot] != nil {
+				it.push(n.Children[slot], path)
+			}
+		case *internal.ShortNode:
+			it.pop()
+			it.push(n.Value, appendPath(top.path, n.Key...))
+		case *internal.ValueNode:
+			it.pop()
+			if it.inRange(top.path) {
+				it.key, it.value = it.batch.key(top.path), n.Value
+				return true
+			}
+		default:
+			it.err = errors.New("[Trie Iterator] Unknown node type")
+		}
+	}
+	return false
+}
+
+// Key returns the key of the current pair.
+func (it *Iterator) Key() []byte { return it.key }
+
+// Value returns the value of the current pair.
+func (it *Iterator) Value() []byte { return it.value }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error { return it.err }
+
+// Close releases the iterator, the transaction is aborted
+// if the iterator was created by Trie.Iterator.
+func (it *Iterator) Close() error {
+	it.stack = nil
+	if it.owned {
+		it.owned = false
+		return it.batch.Abort()
+	}
+	return nil
+}
+
+// push adds the node at path to the walk, unless no key under path is in range
+func (it *Iterator) push(node internal.Node, path []byte) {
+	n := len(path)
+	if len(it.lower) < n {
+		n = len(it.lower)
+	}
+	if bytes.Compare(path, it.lower[:n]) < 0 {
+		return
+	}
+	if it.upper != nil && bytes.Compare(path, it.upper) >= 0 {
+		return
+	}
+	frame := &iteratorFrame{node: node, path: path}
+	if it.reverse {
+		frame.next = 256
+	}
+	it.stack = append(it.stack, frame)
+}
+
+func (it *Iterator) pop() {
+	it.stack = it.stack[:len(it.stack)-1]
+}
+
+func (it *Iterator) inRange(key []byte) bool {
+	return bytes.Compare(key, it.lower) >= 0 && (it.upper == nil || bytes.Compare(key, it.upper) < 0)
+}
+
+// prefixEnd returns the smallest key greater than every key starting with prefix,
+// or nil if there is no such key
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte{}, prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+func appendPath(path []byte, segment ...byte) []byte {
+	ret := make([]byte, 0, len(path)+len(segment))
+	ret = append(ret, path...)
+	return append(ret, segment...)
+}
@@ -0,0 +1,195 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func newIteratorTrie(t *testing.T, keys []string) *Trie {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	batch, _ := trie.Batch(nil)
+	for _, k := range keys {
+		if err := batch.Put([]byte(k), []byte(k+"_value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return trie
+}
+
+func randomKeys(n int) []string {
+	r := rand.New(rand.NewSource(1))
+	keys := map[string]bool{"": true}
+	for len(keys) < n {
+		k := make([]byte, r.Intn(6))
+		for i := range k {
+			k[i] = byte('a' + r.Intn(4))
+		}
+		keys[string(k)] = true
+	}
+	ret := make([]string, 0, len(keys))
+	for k := range keys {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func collect(t *testing.T, it *Iterator) []string {
+	defer it.Close()
+	var ret []string
+	for it.Next() {
+		if !bytes.Equal(it.Value(), append(it.Key(), "_value"...)) {
+			t.Fatalf("key %q: value not equal", it.Key())
+		}
+		ret = append(ret, string(it.Key()))
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	return ret
+}
+
+func TestTrieIterator(t *testing.T) {
+	keys := randomKeys(200)
+	trie := newIteratorTrie(t, keys)
+
+	for _, start := range []string{"", "a", "abc", "abcdz", "b", "bb", "d", "e"} {
+		it, err := trie.Iterator([]byte(start))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := collect(t, it)
+		expected := keys[sort.SearchStrings(keys, start):]
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Fatalf("start %q: expected %v, got %v", start, expected, got)
+		}
+	}
+}
+
+func TestBatchIteratorUncommitted(t *testing.T) {
+	trie := newIteratorTrie(t, []string{"a", "b", "c"})
+	batch, _ := trie.Batch(nil)
+	defer batch.Abort()
+	batch.Put([]byte("ab"), []byte("ab_value"))
+	batch.Delete([]byte("b"))
+
+	got := collect(t, batch.Iterator(nil))
+	if fmt.Sprint(got) != fmt.Sprint([]string{"a", "ab", "c"}) {
+		t.Fatalf("unexpected keys %v", got)
+	}
+}
+
+func TestTrieIteratorEmpty(t *testing.T) {
+	trie := newIteratorTrie(t, nil)
+	it, err := trie.Iterator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := collect(t, it); len(got) != 0 {
+		t.Fatalf("unexpected keys %v", got)
+	}
+}
+
+func reversed(keys []string) []string {
+	ret := make([]string, len(keys))
+	for i, k := range keys {
+		ret[len(keys)-1-i] = k
+	}
+	return ret
+}
+
+func TestBatchRange(t *testing.T) {
+	keys := randomKeys(200)
+	trie := newIteratorTrie(t, keys)
+	batch, _ := trie.Batch(nil)
+	defer batch.Abort()
+
+	ranges := [][2]string{{"", ""}, {"a", "b"}, {"ab", "abd"}, {"abc", "abc"}, {"b", "a"}, {"c", "zz"}}
+	for _, r := range ranges {
+		var expected []string
+		for _, k := range keys {
+			if k >= r[0] && k < r[1] {
+				expected = append(expected, k)
+			}
+		}
+		got := collect(t, batch.Range([]byte(r[0]), []byte(r[1]), false))
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Fatalf("range %q: expected %v, got %v", r, expected, got)
+		}
+		got = collect(t, batch.Range([]byte(r[0]), []byte(r[1]), true))
+		if fmt.Sprint(got) != fmt.Sprint(reversed(expected)) {
+			t.Fatalf("reverse range %q: expected %v, got %v", r, reversed(expected), got)
+		}
+	}
+
+	got := collect(t, batch.Range(nil, nil, true))
+	if fmt.Sprint(got) != fmt.Sprint(reversed(keys)) {
+		t.Fatalf("expected %v, got %v", reversed(keys), got)
+	}
+}
+
+func TestBatchScanPrefix(t *testing.T) {
+	keys := randomKeys(200)
+	trie := newIteratorTrie(t, append(keys, "\xff", "\xff\xff\x01"))
+	batch, _ := trie.Batch(nil)
+	defer batch.Abort()
+
+	for _, prefix := range []string{"", "a", "ab", "abcd", "e", "\xff"} {
+		var expected []string
+		for _, k := range append(keys, "\xff", "\xff\xff\x01") {
+			if len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+				expected = append(expected, k)
+			}
+		}
+		got := collect(t, batch.ScanPrefix([]byte(prefix), false))
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Fatalf("prefix %q: expected %v, got %v", prefix, expected, got)
+		}
+		got = collect(t, batch.ScanPrefix([]byte(prefix), true))
+		if fmt.Sprint(got) != fmt.Sprint(reversed(expected)) {
+			t.Fatalf("reverse prefix %q: expected %v, got %v", prefix, reversed(expected), got)
+		}
+	}
+}
+
+func TestBatchScanPrefixLoadsSubtreeOnly(t *testing.T) {
+	trie := newIteratorTrie(t, []string{"aa", "ab", "ba", "bb", "ca", "cb"})
+	kv := trie.kv.(*MapKv)
+
+	// drop every node except the ones on the way to prefix "b"
+	batch, _ := trie.Batch(nil)
+	needed := map[string]bool{string(trie.rootKey): true}
+	for _, k := range []string{"ba", "bb"} {
+		proof, err := batch.Prove([]byte(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, data := range proof {
+			h := crypto.SHA256.New()
+			h.Write(data)
+			needed[string(h.Sum(nil))] = true
+		}
+	}
+	batch.Abort()
+	for k := range kv.kv {
+		if !needed[k] {
+			delete(kv.kv, k)
+		}
+	}
+
+	batch, _ = trie.Batch(nil)
+	got := collect(t, batch.ScanPrefix([]byte("b"), true))
+	if fmt.Sprint(got) != fmt.Sprint([]string{"bb", "ba"}) {
+		t.Fatalf("unexpected keys %v", got)
+	}
+}
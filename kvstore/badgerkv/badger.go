@@ -0,0 +1,86 @@
+// Package badgerkv adapts a badger database to api.TransactionalKvStorage.
+package badgerkv
+
+import (
+	"errors"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvstore"
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Store is a badger database used as kv storage.
+// A transaction reads a read-only badger transaction and buffers its writes,
+// which are written by a badger write batch on commit, so a trie batch is not bound
+// by the size limit of a badger transaction. The write batch commits in one badger
+// transaction as long as the writes fit in it, a larger commit is split in several
+// and is not atomic. Concurrent transactions writing the same keys are not detected,
+// the last commit wins.
+type Store struct {
+	db *badger.DB
+}
+
+func New(db *badger.DB) *Store {
+	return &Store{db: db}
+}
+
+// Open opens or creates the database in the directory path, writes are synced.
+func Open(path string) (*Store, error) {
+	db, err := badger.Open(badger.DefaultOptions(path).WithSyncWrites(true).WithLogger(nil))
+	if err != nil {
+		return nil, err
+	}
+	return New(db), nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Transaction() (api.KvStorageTransaction, error) {
+	txn := s.db.NewTransaction(false)
+	get := func(key []byte) ([]byte, error) {
+		item, err := txn.Get(key)
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, api.NotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		return item.ValueCopy(nil)
+	}
+	return kvstore.NewBufferedTransaction(get, s.write, txn.Discard), nil
+}
+
+func (s *Store) write(writes []kvstore.Write) error {
+	batch := s.db.NewWriteBatch()
+	defer batch.Cancel()
+	for _, w := range writes {
+		var err error
+		if w.Delete {
+			err = batch.Delete(w.Key)
+		} else {
+			err = batch.Set(w.Key, w.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+// Keys returns at most limit keys greater than or equal to start.
+func (s *Store) Keys(start []byte, limit int) ([][]byte, error) {
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(start); it.Valid() && len(keys) < limit; it.Next() {
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	return keys, err
+}
@@ -0,0 +1,43 @@
+package badgerkv
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvtest"
+)
+
+func TestConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T) api.TransactionalKvStorage {
+		s, err := Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
+
+func TestLargeTransaction(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	// more writes than a single badger transaction holds
+	const count = 300000
+	txn, _ := s.Transaction()
+	for i := 0; i < count; i++ {
+		if err := txn.Put([]byte(fmt.Sprint("key", i)), []byte(fmt.Sprint("value", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := s.Keys(nil, count+1)
+	if err != nil || len(keys) != count {
+		t.Fatalf("%d keys: %v", len(keys), err)
+	}
+}
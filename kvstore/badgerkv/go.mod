@@ -0,0 +1,28 @@
+module github.com/MetaDataLab/go-MerklePatriciaTree/kvstore/badgerkv
+
+go 1.20
+
+require (
+	github.com/MetaDataLab/go-MerklePatriciaTree v0.0.0-00010101000000-000000000000
+	github.com/dgraph-io/badger/v4 v4.2.0
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgraph-io/ristretto v0.1.1 // indirect
+	github.com/dustin/go-humanize v1.0.0 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/golang/glog v1.0.0 // indirect
+	github.com/golang/groupcache v0.0.0-20190702054246-869f871628b6 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/google/flatbuffers v1.12.1 // indirect
+	github.com/klauspost/compress v1.12.3 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	go.opencensus.io v0.22.5 // indirect
+	golang.org/x/net v0.7.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+	google.golang.org/protobuf v1.31.0 // indirect
+)
+
+replace github.com/MetaDataLab/go-MerklePatriciaTree => ../..
@@ -0,0 +1,108 @@
+// Package boltkv adapts a bbolt database to api.TransactionalKvStorage.
+package boltkv
+
+import (
+	"bytes"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvstore"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultBucket holds the keys of a store opened with Open
+var DefaultBucket = []byte("mpt")
+
+// Store is a bucket of a bbolt database used as kv storage.
+// A transaction reads through a read-only bbolt transaction and buffers its writes,
+// which are written in one read-write bbolt transaction on commit.
+// Concurrent transactions writing the same keys are not detected, the last commit wins.
+//
+// bbolt waits for read-only transactions to end to grow its memory map,
+// so a commit blocks while the committing goroutine keeps another transaction open
+// and the database outgrows its map, which should be large enough for the database.
+type Store struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+// New uses bucket of db as kv storage, the bucket is created if needed.
+func New(db *bolt.DB, bucket []byte) (*Store, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db, bucket: bucket}, nil
+}
+
+// initialMmapSize is mapped by Open, so that the map only grows with large databases
+const initialMmapSize = 1 << 30
+
+// Open opens or creates the database file at path and uses its DefaultBucket.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{InitialMmapSize: initialMmapSize})
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(db, DefaultBucket)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Transaction() (api.KvStorageTransaction, error) {
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	bucket := tx.Bucket(s.bucket)
+	get := func(key []byte) ([]byte, error) {
+		val := bucket.Get(key)
+		if val == nil {
+			return nil, api.NotFound
+		}
+		// the value is only valid during the bbolt transaction
+		return append([]byte{}, val...), nil
+	}
+	release := func() { tx.Rollback() }
+	return kvstore.NewBufferedTransaction(get, s.write, release), nil
+}
+
+func (s *Store) write(writes []kvstore.Write) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(s.bucket)
+		for _, w := range writes {
+			var err error
+			if w.Delete {
+				err = bucket.Delete(w.Key)
+			} else {
+				err = bucket.Put(w.Key, w.Value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Keys returns at most limit keys greater than or equal to start.
+func (s *Store) Keys(start []byte, limit int) ([][]byte, error) {
+	var keys [][]byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(s.bucket).Cursor()
+		for k, _ := c.Seek(start); k != nil && len(keys) < limit; k, _ = c.Next() {
+			keys = append(keys, bytes.Clone(k))
+		}
+		return nil
+	})
+	return keys, err
+}
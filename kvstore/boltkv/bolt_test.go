@@ -0,0 +1,20 @@
+package boltkv
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvtest"
+)
+
+func TestConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T) api.TransactionalKvStorage {
+		s, err := Open(filepath.Join(t.TempDir(), "mpt.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
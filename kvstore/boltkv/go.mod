@@ -0,0 +1,12 @@
+module github.com/MetaDataLab/go-MerklePatriciaTree/kvstore/boltkv
+
+go 1.22
+
+require (
+	github.com/MetaDataLab/go-MerklePatriciaTree v0.0.0-00010101000000-000000000000
+	go.etcd.io/bbolt v1.3.11
+)
+
+require golang.org/x/sys v0.15.0 // indirect
+
+replace github.com/MetaDataLab/go-MerklePatriciaTree => ../..
@@ -0,0 +1,52 @@
+package kvstore
+
+import (
+	"sort"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+// Write is a change committed by a buffered transaction, Value is nil for a delete
+type Write struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// NewBufferedTransaction returns a transaction for an engine which only provides
+// snapshots and atomic write batches. The transaction buffers its writes and reads them back,
+// other keys are read with get, which must return api.NotFound for a missing key.
+// release is called once when the transaction ends, before commit which receives
+// the buffered writes in key order.
+func NewBufferedTransaction(get func(key []byte) ([]byte, error), commit func([]Write) error, release func()) api.KvStorageTransaction {
+	return newTransaction(&buffered{get: get, apply: commit, release: release}, 0)
+}
+
+type buffered struct {
+	get     func(key []byte) ([]byte, error)
+	apply   func([]Write) error
+	release func()
+}
+
+func (b *buffered) read(key string, _ uint64) ([]byte, error) {
+	return b.get([]byte(key))
+}
+
+func (b *buffered) end(uint64) {
+	b.release()
+}
+
+func (b *buffered) commit(_ uint64, writes map[string]write[[]byte]) error {
+	b.release()
+	if len(writes) == 0 {
+		return nil
+	}
+	ret := make([]Write, 0, len(writes))
+	for key, w := range writes {
+		ret = append(ret, Write{Key: []byte(key), Value: w.value, Delete: w.deleted})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return string(ret[i].Key) < string(ret[j].Key)
+	})
+	return b.apply(ret)
+}
@@ -0,0 +1,436 @@
+package kvstore
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+// fileMagic starts every log file
+var fileMagic = []byte("MPTLOG1\n")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+const (
+	opPut byte = iota + 1
+	opDelete
+	opCommit
+)
+
+// commitRecordSize is the op byte, the 64 bits length and the checksum of the transaction
+const commitRecordSize = 13
+
+// compactTxnSize bounds the size of the transactions written by compaction
+const compactTxnSize = 4 << 20
+
+var (
+	// StoreClosed is returned when a closed FileKVStore is written
+	StoreClosed = errors.New("store closed")
+	// CorruptedLog is returned when a transaction which is followed by others in the log is damaged
+	CorruptedLog = errors.New("corrupted log")
+)
+
+// errTornTail ends the replay at a transaction running past the end of the log
+var errTornTail = errors.New("torn transaction")
+
+// valuePos locates a value in the log file
+type valuePos struct {
+	offset int64
+	length int
+}
+
+// FileKVStore is a persistent api.TransactionalKvStorage in a single append-only log file.
+// Transactions have the same isolation as MemKVStore. A committed transaction is appended
+// as its put and delete records followed by a commit record, which holds the length and the
+// checksum of the records, and the file is synced before Commit returns.
+// On open the log is replayed, a torn or corrupted transaction at the end of the file,
+// left by a crash during a commit, is truncated. A damaged transaction followed by others
+// fails the open with CorruptedLog and the file is left as is.
+//
+// Only the index of the keys is kept in memory, values are read from the file.
+// Overwritten and deleted values stay in the log until CompactFileKVStore is run.
+type FileKVStore struct {
+	db *mvcc[valuePos]
+	// mu is only taken exclusively to close the file,
+	// reads and the commits, which db serializes, share it
+	mu   sync.RWMutex
+	f    *os.File
+	size int64
+}
+
+// OpenFileKVStore opens the log file at path, creating it if needed.
+func OpenFileKVStore(path string) (*FileKVStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileKVStore{
+		db: newMvcc[valuePos](),
+		f:  f,
+	}
+	if err := s.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the log file, open transactions cannot be used anymore.
+func (s *FileKVStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
+func (s *FileKVStore) Transaction() (api.KvStorageTransaction, error) {
+	s.mu.RLock()
+	closed := s.f == nil
+	s.mu.RUnlock()
+	if closed {
+		return nil, StoreClosed
+	}
+	return newTransaction(s, s.db.begin()), nil
+}
+
+// Keys returns at most limit committed keys greater than or equal to start.
+func (s *FileKVStore) Keys(start []byte, limit int) ([][]byte, error) {
+	return toBytes(s.db.latest(string(start), limit)), nil
+}
+
+func (s *FileKVStore) read(key string, snapshot uint64) ([]byte, error) {
+	pos, ok := s.db.get(key, snapshot)
+	if !ok {
+		return nil, api.NotFound
+	}
+	s.mu.RLock()
+	f := s.f
+	s.mu.RUnlock()
+	if f == nil {
+		return nil, StoreClosed
+	}
+	val := make([]byte, pos.length)
+	if _, err := f.ReadAt(val, pos.offset); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
+func (s *FileKVStore) end(snapshot uint64) {
+	s.db.end(snapshot)
+}
+
+func (s *FileKVStore) commit(snapshot uint64, writes map[string]write[[]byte]) error {
+	if len(writes) == 0 {
+		s.db.end(snapshot)
+		return nil
+	}
+	positions := make(map[string]write[valuePos], len(writes))
+	for key, w := range writes {
+		positions[key] = write[valuePos]{deleted: w.deleted}
+	}
+	return s.db.commit(snapshot, positions, func(uint64) error {
+		return s.append(writes, positions)
+	})
+}
+
+// append writes a transaction at the end of the log and syncs it,
+// the positions of the written values are set in positions
+func (s *FileKVStore) append(writes map[string]write[[]byte], positions map[string]write[valuePos]) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.f == nil {
+		return StoreClosed
+	}
+	keys := make([]string, 0, len(writes))
+	for key := range writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, key := range keys {
+		w := writes[key]
+		if w.deleted {
+			buf.WriteByte(opDelete)
+			writeBytes(&buf, []byte(key))
+			continue
+		}
+		buf.WriteByte(opPut)
+		writeBytes(&buf, []byte(key))
+		writeUvarint(&buf, uint64(len(w.value)))
+		positions[key] = write[valuePos]{value: valuePos{
+			offset: s.size + int64(buf.Len()),
+			length: len(w.value),
+		}}
+		buf.Write(w.value)
+	}
+	records := buf.Len()
+	var commit [commitRecordSize]byte
+	commit[0] = opCommit
+	binary.BigEndian.PutUint64(commit[1:], uint64(records))
+	binary.BigEndian.PutUint32(commit[9:], crc32.Checksum(buf.Bytes(), crcTable))
+	buf.Write(commit[:])
+
+	if _, err := s.f.WriteAt(buf.Bytes(), s.size); err != nil {
+		s.f.Truncate(s.size)
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		s.f.Truncate(s.size)
+		return err
+	}
+	s.size += int64(buf.Len())
+	return nil
+}
+
+// recover replays the log into the index and truncates the incomplete tail
+func (s *FileKVStore) recover() error {
+	info, err := s.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size < int64(len(fileMagic)) {
+		// a new file, or a crash before the header was synced
+		if err := s.f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := s.f.WriteAt(fileMagic, 0); err != nil {
+			return err
+		}
+		if err := s.f.Sync(); err != nil {
+			return err
+		}
+		s.size = int64(len(fileMagic))
+		return nil
+	}
+
+	r := &logReader{
+		r:      bufio.NewReader(io.NewSectionReader(s.f, 0, size)),
+		remain: size,
+	}
+	magic := make([]byte, len(fileMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return err
+	}
+	if !bytes.Equal(magic, fileMagic) {
+		return errors.New("[File KV Store] not a log file")
+	}
+	for {
+		writes, err := r.readTransaction()
+		if errors.Is(err, errTornTail) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.db.commit(s.db.begin(), writes, nil); err != nil {
+			return err
+		}
+		r.mark = r.offset
+	}
+	s.size = r.mark
+	if s.size < size {
+		if err := s.f.Truncate(s.size); err != nil {
+			return err
+		}
+		return s.f.Sync()
+	}
+	return nil
+}
+
+// logReader reads the transactions of a log file,
+// keeping the offset and the checksum of the bytes read
+type logReader struct {
+	r      *bufio.Reader
+	offset int64
+	// end of the last complete transaction
+	mark   int64
+	remain int64
+	crc    uint32
+}
+
+func (r *logReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.consume(p[:n])
+	return n, err
+}
+
+func (r *logReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.consume([]byte{b})
+	}
+	return b, err
+}
+
+func (r *logReader) consume(p []byte) {
+	r.offset += int64(len(p))
+	r.remain -= int64(len(p))
+	r.crc = crc32.Update(r.crc, crcTable, p)
+}
+
+// readLength reads the length of a byte string, a string running past the end of the file is torn
+func (r *logReader) readLength(start int64) (int, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, r.failed(start, fmt.Errorf("%w: %w", CorruptedLog, err))
+	}
+	if length > uint64(r.remain) {
+		return 0, errTornTail
+	}
+	return int(length), nil
+}
+
+// failed returns the error ending the replay at the transaction starting at start:
+// errTornTail if it runs past the end of the file or is the last one, CorruptedLog otherwise
+func (r *logReader) failed(start int64, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || r.remain == 0 {
+		return errTornTail
+	}
+	if !errors.Is(err, CorruptedLog) {
+		return err
+	}
+	return fmt.Errorf("[File KV Store] transaction at offset %d: %w", start, err)
+}
+
+// readTransaction reads the records of a transaction up to its commit record,
+// it returns errTornTail at the end of the log or on a torn transaction
+func (r *logReader) readTransaction() (map[string]write[valuePos], error) {
+	writes := map[string]write[valuePos]{}
+	start := r.offset
+	r.crc = 0
+	for {
+		records, crc := r.offset-start, r.crc
+		op, err := r.ReadByte()
+		if err != nil {
+			return nil, r.failed(start, err)
+		}
+		switch op {
+		case opPut, opDelete:
+			length, err := r.readLength(start)
+			if err != nil {
+				return nil, err
+			}
+			key := make([]byte, length)
+			if _, err := io.ReadFull(r, key); err != nil {
+				return nil, r.failed(start, err)
+			}
+			if op == opDelete {
+				writes[string(key)] = write[valuePos]{deleted: true}
+				continue
+			}
+			if length, err = r.readLength(start); err != nil {
+				return nil, err
+			}
+			pos := valuePos{offset: r.offset, length: length}
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				return nil, r.failed(start, err)
+			}
+			writes[string(key)] = write[valuePos]{value: pos}
+		case opCommit:
+			var commit [commitRecordSize - 1]byte
+			if _, err := io.ReadFull(r, commit[:]); err != nil {
+				return nil, r.failed(start, err)
+			}
+			if binary.BigEndian.Uint64(commit[:8]) != uint64(records) ||
+				binary.BigEndian.Uint32(commit[8:]) != crc {
+				return nil, r.failed(start, fmt.Errorf("%w: checksum mismatch", CorruptedLog))
+			}
+			return writes, nil
+		default:
+			return nil, r.failed(start, fmt.Errorf("%w: unknown record %d", CorruptedLog, op))
+		}
+	}
+}
+
+// CompactFileKVStore rewrites the log file at path with the latest value of each key only.
+// It runs offline, the store must not be open. The compacted log is written next to the file
+// and replaces it once synced, so a crash leaves either the old or the compacted log.
+func CompactFileKVStore(path string) error {
+	s, err := OpenFileKVStore(path)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	tmp := path + ".compact"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	out, err := OpenFileKVStore(tmp)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	src, _ := s.Transaction()
+	defer src.Abort()
+	dst, _ := out.Transaction()
+	size := 0
+	var start string
+	for {
+		keys := s.db.latest(start, 1024)
+		if len(keys) == 0 {
+			break
+		}
+		for _, key := range keys {
+			val, err := src.Get([]byte(key))
+			if err != nil {
+				dst.Abort()
+				return err
+			}
+			dst.Put([]byte(key), val)
+			size += len(key) + len(val)
+			if size < compactTxnSize {
+				continue
+			}
+			if err := dst.Commit(); err != nil {
+				return err
+			}
+			dst, _ = out.Transaction()
+			size = 0
+		}
+		start = keys[len(keys)-1] + "\x00"
+	}
+	if err := dst.Commit(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+func writeUvarint(buf *bytes.Buffer, v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	buf.Write(tmp[:n])
+}
+
+func writeBytes(buf *bytes.Buffer, data []byte) {
+	writeUvarint(buf, uint64(len(data)))
+	buf.Write(data)
+}
@@ -0,0 +1,234 @@
+package kvstore
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	mpt "github.com/MetaDataLab/go-MerklePatriciaTree"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+func commitPairs(t *testing.T, s api.TransactionalKvStorage, pairs ...string) {
+	t.Helper()
+	txn, _ := s.Transaction()
+	for i := 0; i < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			txn.Delete([]byte(pairs[i]))
+		} else {
+			txn.Put([]byte(pairs[i]), []byte(pairs[i+1]))
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func checkPairs(t *testing.T, s api.TransactionalKvStorage, pairs ...string) {
+	t.Helper()
+	txn, _ := s.Transaction()
+	defer txn.Abort()
+	for i := 0; i < len(pairs); i += 2 {
+		val, err := txn.Get([]byte(pairs[i]))
+		if pairs[i+1] == "" {
+			if !errors.Is(err, api.NotFound) {
+				t.Fatalf("key %q: expected not found, got %q %v", pairs[i], val, err)
+			}
+			continue
+		}
+		if err != nil || string(val) != pairs[i+1] {
+			t.Fatalf("key %q: expected %q, got %q %v", pairs[i], pairs[i+1], val, err)
+		}
+	}
+}
+
+func TestFileKVStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.log")
+	s, err := OpenFileKVStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commitPairs(t, s, "a", "1", "b", "2", "c", "3")
+	commitPairs(t, s, "a", "4", "b", "")
+	txn, _ := s.Transaction()
+	txn.Put([]byte("d"), []byte("aborted"))
+	txn.Abort()
+	checkPairs(t, s, "a", "4", "b", "", "c", "3", "d", "")
+	s.Close()
+	if _, err := s.Transaction(); !errors.Is(err, StoreClosed) {
+		t.Fatal("closed store still usable")
+	}
+
+	s, err = OpenFileKVStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkPairs(t, s, "a", "4", "b", "", "c", "3", "d", "")
+	keys, _ := s.Keys([]byte("b"), 10)
+	if len(keys) != 1 || string(keys[0]) != "c" {
+		t.Fatalf("keys %q", keys)
+	}
+}
+
+func TestFileKVStoreTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.log")
+	s, _ := OpenFileKVStore(path)
+	commitPairs(t, s, "a", "1")
+	info, _ := os.Stat(path)
+	committed := info.Size()
+	commitPairs(t, s, "a", "2", "b", "2")
+	info, _ = os.Stat(path)
+	full := info.Size()
+	s.Close()
+	data, _ := os.ReadFile(path)
+
+	// every truncation of the last transaction drops it entirely
+	for size := committed; size < full; size++ {
+		os.WriteFile(path, data[:size], 0644)
+		s, err := OpenFileKVStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkPairs(t, s, "a", "1", "b", "")
+		// new commits go after the last complete transaction
+		commitPairs(t, s, "c", "3")
+		s.Close()
+		s, _ = OpenFileKVStore(path)
+		checkPairs(t, s, "a", "1", "b", "", "c", "3")
+		s.Close()
+	}
+
+	// a corrupted value is detected by the checksum
+	corrupted := append([]byte{}, data...)
+	corrupted[full-commitRecordSize-1] ^= 0xff
+	os.WriteFile(path, corrupted, 0644)
+	s, _ = OpenFileKVStore(path)
+	defer s.Close()
+	checkPairs(t, s, "a", "1", "b", "")
+}
+
+func TestFileKVStoreCorruptedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.log")
+	s, _ := OpenFileKVStore(path)
+	commitPairs(t, s, "a", "1")
+	info, _ := os.Stat(path)
+	start := info.Size()
+	commitPairs(t, s, "b", "2")
+	info, _ = os.Stat(path)
+	end := info.Size()
+	commitPairs(t, s, "c", "3")
+	s.Close()
+	data, _ := os.ReadFile(path)
+
+	// a damaged transaction followed by a synced one is not a torn tail
+	for name, offset := range map[string]int64{
+		"record":   start,
+		"value":    end - commitRecordSize - 1,
+		"checksum": end - 1,
+	} {
+		corrupted := append([]byte{}, data...)
+		corrupted[offset] ^= 0xff
+		os.WriteFile(path, corrupted, 0644)
+		if _, err := OpenFileKVStore(path); !errors.Is(err, CorruptedLog) {
+			t.Fatalf("%s: expected CorruptedLog, got %v", name, err)
+		}
+		if info, _ := os.Stat(path); info.Size() != int64(len(data)) {
+			t.Fatalf("%s: log truncated to %d bytes", name, info.Size())
+		}
+	}
+}
+
+func TestMvccReadWhilePersisting(t *testing.T) {
+	db := newMvcc[string]()
+	db.commit(db.begin(), map[string]write[string]{"a": {value: "1"}}, nil)
+	persisting, synced := make(chan struct{}), make(chan struct{})
+	committed := make(chan error)
+	go func() {
+		committed <- db.commit(db.begin(), map[string]write[string]{"a": {value: "2"}}, func(uint64) error {
+			close(persisting)
+			<-synced
+			return nil
+		})
+	}()
+	<-persisting
+
+	// the transactions begin and read the last visible snapshot while the log is synced
+	snapshot := db.begin()
+	if val, ok := db.get("a", snapshot); !ok || val != "1" {
+		t.Fatalf("got %q %v while persisting", val, ok)
+	}
+	db.end(snapshot)
+	close(synced)
+	if err := <-committed; err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := db.get("a", db.begin()); val != "2" {
+		t.Fatalf("got %q after the commit", val)
+	}
+}
+
+func TestFileKVStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.log")
+	s, _ := OpenFileKVStore(path)
+	for i := 0; i < 100; i++ {
+		commitPairs(t, s, "counter", fmt.Sprint(i), fmt.Sprintf("key%d", i), "value")
+		if i%2 == 1 {
+			commitPairs(t, s, fmt.Sprintf("key%d", i), "")
+		}
+	}
+	s.Close()
+	info, _ := os.Stat(path)
+	before := info.Size()
+
+	if err := CompactFileKVStore(path); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = os.Stat(path)
+	if info.Size() >= before {
+		t.Fatalf("log not compacted: %d >= %d", info.Size(), before)
+	}
+	s, err := OpenFileKVStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	checkPairs(t, s, "counter", "99", "key0", "value", "key1", "", "key98", "value", "key99", "")
+	keys, _ := s.Keys(nil, 1000)
+	if len(keys) != 51 {
+		t.Fatalf("%d keys after compaction", len(keys))
+	}
+}
+
+func TestFileKVStoreTrie(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.log")
+	s, _ := OpenFileKVStore(path)
+	trie := mpt.New(crypto.SHA256.New, s, []byte("root"))
+	for i := 0; i < 100; i++ {
+		if err := trie.Put([]byte(fmt.Sprint(i)), []byte(fmt.Sprint("value", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rootHash, _ := trie.RootHash()
+	s.Close()
+
+	if err := CompactFileKVStore(path); err != nil {
+		t.Fatal(err)
+	}
+	s, _ = OpenFileKVStore(path)
+	defer s.Close()
+	trie = mpt.New(crypto.SHA256.New, s, []byte("root"))
+	if h, _ := trie.RootHash(); !bytes.Equal(h, rootHash) {
+		t.Fatal("root lost on restart")
+	}
+	for i := 0; i < 100; i++ {
+		val, err := trie.Get([]byte(fmt.Sprint(i)))
+		if err != nil || string(val) != fmt.Sprint("value", i) {
+			t.Fatalf("key %d: %q %v", i, val, err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package kvstore
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvtest"
+)
+
+func TestMemKVStoreConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T) api.TransactionalKvStorage {
+		return NewMemKVStore()
+	})
+}
+
+func TestFileKVStoreConformance(t *testing.T) {
+	kvtest.Run(t, func(t *testing.T) api.TransactionalKvStorage {
+		s, err := OpenFileKVStore(filepath.Join(t.TempDir(), "kv.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
@@ -0,0 +1,12 @@
+module github.com/MetaDataLab/go-MerklePatriciaTree/kvstore/leveldbkv
+
+go 1.20
+
+require (
+	github.com/MetaDataLab/go-MerklePatriciaTree v0.0.0-00010101000000-000000000000
+	github.com/syndtr/goleveldb v1.0.1-0.20220721030215-126854af5e6d
+)
+
+require github.com/golang/snappy v0.0.4 // indirect
+
+replace github.com/MetaDataLab/go-MerklePatriciaTree => ../..
@@ -0,0 +1,75 @@
+// Package leveldbkv adapts a goleveldb database to api.TransactionalKvStorage.
+package leveldbkv
+
+import (
+	"errors"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvstore"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Store is a goleveldb database used as kv storage.
+// A transaction reads a snapshot of the database and buffers its writes,
+// which are written in one synced batch on commit. Concurrent transactions
+// writing the same keys are not detected, the last commit wins.
+type Store struct {
+	db *leveldb.DB
+}
+
+func New(db *leveldb.DB) *Store {
+	return &Store{db: db}
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*Store, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return New(db), nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Transaction() (api.KvStorageTransaction, error) {
+	snapshot, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	get := func(key []byte) ([]byte, error) {
+		val, err := snapshot.Get(key, nil)
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, api.NotFound
+		}
+		return val, err
+	}
+	return kvstore.NewBufferedTransaction(get, s.write, snapshot.Release), nil
+}
+
+func (s *Store) write(writes []kvstore.Write) error {
+	batch := new(leveldb.Batch)
+	for _, w := range writes {
+		if w.Delete {
+			batch.Delete(w.Key)
+		} else {
+			batch.Put(w.Key, w.Value)
+		}
+	}
+	return s.db.Write(batch, &opt.WriteOptions{Sync: true})
+}
+
+// Keys returns at most limit keys greater than or equal to start.
+func (s *Store) Keys(start []byte, limit int) ([][]byte, error) {
+	it := s.db.NewIterator(&util.Range{Start: start}, nil)
+	defer it.Release()
+	var keys [][]byte
+	for len(keys) < limit && it.Next() {
+		keys = append(keys, append([]byte{}, it.Key()...))
+	}
+	return keys, it.Error()
+}
@@ -0,0 +1,52 @@
+package kvstore
+
+import (
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+// MemKVStore is an in-memory api.TransactionalKvStorage.
+// Transactions buffer their writes until Commit, read their own writes
+// and read the snapshot committed when they started, a commit fails with
+// TxnConflict if another transaction committed one of its keys meanwhile.
+type MemKVStore struct {
+	db *mvcc[[]byte]
+}
+
+func NewMemKVStore() *MemKVStore {
+	return &MemKVStore{
+		db: newMvcc[[]byte](),
+	}
+}
+
+func (s *MemKVStore) Transaction() (api.KvStorageTransaction, error) {
+	return newTransaction(s, s.db.begin()), nil
+}
+
+// Keys returns at most limit committed keys greater than or equal to start.
+func (s *MemKVStore) Keys(start []byte, limit int) ([][]byte, error) {
+	return toBytes(s.db.latest(string(start), limit)), nil
+}
+
+func (s *MemKVStore) read(key string, snapshot uint64) ([]byte, error) {
+	val, ok := s.db.get(key, snapshot)
+	if !ok {
+		return nil, api.NotFound
+	}
+	return append([]byte{}, val...), nil
+}
+
+func (s *MemKVStore) end(snapshot uint64) {
+	s.db.end(snapshot)
+}
+
+func (s *MemKVStore) commit(snapshot uint64, writes map[string]write[[]byte]) error {
+	return s.db.commit(snapshot, writes, nil)
+}
+
+func toBytes(keys []string) [][]byte {
+	ret := make([][]byte, len(keys))
+	for i, key := range keys {
+		ret[i] = []byte(key)
+	}
+	return ret
+}
@@ -0,0 +1,198 @@
+package kvstore
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	mpt "github.com/MetaDataLab/go-MerklePatriciaTree"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+func mustGet(t *testing.T, txn api.KvStorageTransaction, key string) []byte {
+	t.Helper()
+	val, err := txn.Get([]byte(key))
+	if err != nil {
+		t.Fatalf("get %q: %s", key, err)
+	}
+	return val
+}
+
+func TestMemKVStoreReadYourWrites(t *testing.T) {
+	s := NewMemKVStore()
+	txn, _ := s.Transaction()
+	if _, err := txn.Get([]byte("a")); !errors.Is(err, api.NotFound) {
+		t.Fatal("missing key found")
+	}
+	val := []byte("1")
+	txn.Put([]byte("a"), val)
+	val[0] = '2'
+	if got := mustGet(t, txn, "a"); !bytes.Equal(got, []byte("1")) {
+		t.Fatalf("got %q", got)
+	}
+
+	// not visible to others before commit
+	other, _ := s.Transaction()
+	if _, err := other.Get([]byte("a")); !errors.Is(err, api.NotFound) {
+		t.Fatal("uncommitted write visible")
+	}
+	other.Abort()
+
+	txn.Delete([]byte("a"))
+	if _, err := txn.Get([]byte("a")); !errors.Is(err, api.NotFound) {
+		t.Fatal("deleted key found")
+	}
+	txn.Put([]byte("b"), []byte("2"))
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Put([]byte("c"), nil); !errors.Is(err, TxnClosed) {
+		t.Fatal("committed transaction still usable")
+	}
+
+	txn, _ = s.Transaction()
+	defer txn.Abort()
+	if _, err := txn.Get([]byte("a")); !errors.Is(err, api.NotFound) {
+		t.Fatal("deleted key committed")
+	}
+	if got := mustGet(t, txn, "b"); !bytes.Equal(got, []byte("2")) {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestMemKVStoreAbort(t *testing.T) {
+	s := NewMemKVStore()
+	txn, _ := s.Transaction()
+	txn.Put([]byte("a"), []byte("1"))
+	txn.Commit()
+
+	txn, _ = s.Transaction()
+	txn.Put([]byte("a"), []byte("2"))
+	txn.Put([]byte("b"), []byte("2"))
+	if err := txn.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	txn, _ = s.Transaction()
+	defer txn.Abort()
+	if got := mustGet(t, txn, "a"); !bytes.Equal(got, []byte("1")) {
+		t.Fatalf("got %q", got)
+	}
+	if _, err := txn.Get([]byte("b")); !errors.Is(err, api.NotFound) {
+		t.Fatal("aborted write committed")
+	}
+	keys, _ := s.Keys(nil, 10)
+	if len(keys) != 1 || string(keys[0]) != "a" {
+		t.Fatalf("keys %q", keys)
+	}
+}
+
+func TestMemKVStoreSnapshotIsolation(t *testing.T) {
+	s := NewMemKVStore()
+	txn, _ := s.Transaction()
+	txn.Put([]byte("a"), []byte("1"))
+	txn.Commit()
+
+	reader, _ := s.Transaction()
+	writer, _ := s.Transaction()
+	writer.Put([]byte("a"), []byte("2"))
+	writer.Delete([]byte("missing"))
+	writer.Put([]byte("b"), []byte("2"))
+	if err := writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the reader keeps the snapshot it started with
+	if got := mustGet(t, reader, "a"); !bytes.Equal(got, []byte("1")) {
+		t.Fatalf("got %q", got)
+	}
+	if _, err := reader.Get([]byte("b")); !errors.Is(err, api.NotFound) {
+		t.Fatal("later commit visible")
+	}
+	// a read only transaction commits without conflict
+	if err := reader.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemKVStoreConflict(t *testing.T) {
+	s := NewMemKVStore()
+	first, _ := s.Transaction()
+	second, _ := s.Transaction()
+	first.Put([]byte("a"), []byte("1"))
+	second.Put([]byte("a"), []byte("2"))
+	second.Put([]byte("b"), []byte("2"))
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Commit(); !errors.Is(err, TxnConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+	txn, _ := s.Transaction()
+	defer txn.Abort()
+	if got := mustGet(t, txn, "a"); !bytes.Equal(got, []byte("1")) {
+		t.Fatalf("got %q", got)
+	}
+	if _, err := txn.Get([]byte("b")); !errors.Is(err, api.NotFound) {
+		t.Fatal("conflicting commit partially applied")
+	}
+}
+
+func TestMemKVStoreConcurrentCounters(t *testing.T) {
+	s := NewMemKVStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 50; {
+				txn, _ := s.Transaction()
+				val, err := txn.Get([]byte("counter"))
+				if err != nil && !errors.Is(err, api.NotFound) {
+					t.Error(err)
+					return
+				}
+				var count int
+				fmt.Sscan(string(val), &count)
+				txn.Put([]byte("counter"), []byte(fmt.Sprint(count+1)))
+				if err := txn.Commit(); err == nil {
+					n++
+				} else if !errors.Is(err, TxnConflict) {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	txn, _ := s.Transaction()
+	defer txn.Abort()
+	if got := string(mustGet(t, txn, "counter")); got != "400" {
+		t.Fatalf("lost updates, counter is %s", got)
+	}
+}
+
+func TestMemKVStoreTrie(t *testing.T) {
+	s := NewMemKVStore()
+	trie := mpt.New(crypto.SHA256.New, s, []byte("root"))
+	if err := trie.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	rootHash, _ := trie.RootHash()
+
+	// an aborted batch leaves the trie untouched
+	batch, _ := trie.Batch(nil)
+	batch.Put([]byte("other"), []byte("value"))
+	batch.Abort()
+	if h, _ := trie.RootHash(); !bytes.Equal(h, rootHash) {
+		t.Fatal("aborted batch changed the root")
+	}
+	if _, err := trie.Get([]byte("other")); err == nil {
+		t.Fatal("aborted put visible")
+	}
+	val, err := trie.Get([]byte("key"))
+	if err != nil || !bytes.Equal(val, []byte("value")) {
+		t.Fatal("committed value lost")
+	}
+}
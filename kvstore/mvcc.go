@@ -0,0 +1,182 @@
+package kvstore
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+var (
+	// TxnConflict is returned by Commit when a key written by the transaction
+	// was committed by another transaction after its snapshot was taken
+	TxnConflict = errors.New("transaction conflict")
+	// TxnClosed is returned when a committed or aborted transaction is used
+	TxnClosed = errors.New("transaction closed")
+)
+
+// version is a committed value of a key, a deleted key ends with a tombstone
+type version[V any] struct {
+	commit  uint64
+	value   V
+	deleted bool
+}
+
+// write is a pending change of a transaction
+type write[V any] struct {
+	value   V
+	deleted bool
+}
+
+// mvcc keeps the committed versions of every key, so that each transaction
+// reads a consistent snapshot while other transactions commit.
+// Old versions are dropped once no open transaction can read them.
+type mvcc[V any] struct {
+	// serializes the commits, so that persist runs without blocking the readers
+	commitMu sync.Mutex
+	mu       sync.RWMutex
+	versions map[string][]version[V]
+	// keys with a live latest version, in ascending order
+	keys  []string
+	clock uint64
+	// number of open transactions reading each snapshot
+	snapshots map[uint64]int
+}
+
+func newMvcc[V any]() *mvcc[V] {
+	return &mvcc[V]{
+		versions:  map[string][]version[V]{},
+		snapshots: map[uint64]int{},
+	}
+}
+
+// begin registers a transaction reading the latest committed snapshot
+func (m *mvcc[V]) begin() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots[m.clock]++
+	return m.clock
+}
+
+// end unregisters a transaction of snapshot
+func (m *mvcc[V]) end(snapshot uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.release(snapshot)
+}
+
+func (m *mvcc[V]) release(snapshot uint64) {
+	m.snapshots[snapshot]--
+	if m.snapshots[snapshot] <= 0 {
+		delete(m.snapshots, snapshot)
+	}
+}
+
+// get returns the value of key visible at snapshot
+func (m *mvcc[V]) get(key string, snapshot uint64) (V, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions := m.versions[key]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].commit <= snapshot {
+			if versions[i].deleted {
+				break
+			}
+			return versions[i].value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+// commit applies writes as a new snapshot, unless one of the keys was committed
+// after snapshot. persist is called under the commit lock before the writes
+// become visible, with the commit timestamp, and aborts the commit on error.
+// Transactions begin and read meanwhile, only other commits wait for persist.
+func (m *mvcc[V]) commit(snapshot uint64, writes map[string]write[V], persist func(uint64) error) error {
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
+	ts, err := m.check(snapshot, writes)
+	if err != nil {
+		return err
+	}
+	if persist != nil {
+		if err := persist(ts); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = ts
+
+	// versions older than the oldest open snapshot are hidden from every transaction
+	oldest := m.clock
+	for snapshot := range m.snapshots {
+		if snapshot < oldest {
+			oldest = snapshot
+		}
+	}
+	for key, w := range writes {
+		m.apply(key, version[V]{commit: ts, value: w.value, deleted: w.deleted}, oldest)
+	}
+	return nil
+}
+
+// check releases snapshot and returns the timestamp of the next commit,
+// the versions only change under the commit lock, which is held by the caller
+func (m *mvcc[V]) check(snapshot uint64, writes map[string]write[V]) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.release(snapshot)
+	for key := range writes {
+		versions := m.versions[key]
+		if len(versions) > 0 && versions[len(versions)-1].commit > snapshot {
+			return 0, TxnConflict
+		}
+	}
+	return m.clock + 1, nil
+}
+
+func (m *mvcc[V]) apply(key string, v version[V], oldest uint64) {
+	versions := m.versions[key]
+	live := len(versions) > 0 && !versions[len(versions)-1].deleted
+	versions = append(versions, v)
+
+	// keep the latest version visible to the oldest snapshot and the newer ones
+	first := 0
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].commit <= oldest {
+			first = i
+			break
+		}
+	}
+	versions = versions[first:]
+	if len(versions) == 1 && versions[0].deleted {
+		delete(m.versions, key)
+	} else {
+		m.versions[key] = versions
+	}
+
+	i := sort.SearchStrings(m.keys, key)
+	switch {
+	case !live && !v.deleted:
+		m.keys = append(m.keys, "")
+		copy(m.keys[i+1:], m.keys[i:])
+		m.keys[i] = key
+	case live && v.deleted:
+		m.keys = append(m.keys[:i], m.keys[i+1:]...)
+	}
+}
+
+// latest returns at most limit keys greater than or equal to start
+// in the latest snapshot, in ascending order
+func (m *mvcc[V]) latest(start string, limit int) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := sort.SearchStrings(m.keys, start)
+	end := i + limit
+	if end > len(m.keys) {
+		end = len(m.keys)
+	}
+	return append([]string{}, m.keys[i:end]...)
+}
@@ -0,0 +1,86 @@
+// Package pebblekv adapts a pebble database to api.TransactionalKvStorage.
+package pebblekv
+
+import (
+	"errors"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/kvstore"
+	"github.com/cockroachdb/pebble"
+)
+
+// Store is a pebble database used as kv storage.
+// A transaction reads a snapshot of the database and buffers its writes,
+// which are written in one synced batch on commit. Concurrent transactions
+// writing the same keys are not detected, the last commit wins.
+type Store struct {
+	db *pebble.DB
+}
+
+func New(db *pebble.DB) *Store {
+	return &Store{db: db}
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*Store, error) {
+	db, err := pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return New(db), nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) Transaction() (api.KvStorageTransaction, error) {
+	snapshot := s.db.NewSnapshot()
+	get := func(key []byte) ([]byte, error) {
+		val, closer, err := snapshot.Get(key)
+		if errors.Is(err, pebble.ErrNotFound) {
+			return nil, api.NotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer closer.Close()
+		return append([]byte{}, val...), nil
+	}
+	release := func() { snapshot.Close() }
+	return kvstore.NewBufferedTransaction(get, s.write, release), nil
+}
+
+func (s *Store) write(writes []kvstore.Write) error {
+	batch := s.db.NewBatch()
+	defer batch.Close()
+	for _, w := range writes {
+		var err error
+		if w.Delete {
+			err = batch.Delete(w.Key, nil)
+		} else {
+			err = batch.Set(w.Key, w.Value, nil)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Commit(pebble.Sync)
+}
+
+// Keys returns at most limit keys greater than or equal to start.
+func (s *Store) Keys(start []byte, limit int) ([][]byte, error) {
+	it, err := s.db.NewIter(&pebble.IterOptions{LowerBound: start})
+	if err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	for valid := it.First(); valid && len(keys) < limit; valid = it.Next() {
+		keys = append(keys, append([]byte{}, it.Key()...))
+	}
+	if err := it.Error(); err != nil {
+		it.Close()
+		return nil, err
+	}
+	return keys, it.Close()
+}
@@ -0,0 +1,75 @@
+package kvstore
+
+import (
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+// backend is a store whose transactions read a snapshot of an mvcc index
+type backend interface {
+	// read returns the value of key in snapshot, or api.NotFound
+	read(key string, snapshot uint64) ([]byte, error)
+	end(snapshot uint64)
+	commit(snapshot uint64, writes map[string]write[[]byte]) error
+}
+
+// transaction buffers its writes until commit and reads its own writes
+type transaction struct {
+	store    backend
+	snapshot uint64
+	writes   map[string]write[[]byte]
+	closed   bool
+}
+
+func newTransaction(store backend, snapshot uint64) *transaction {
+	return &transaction{
+		store:    store,
+		snapshot: snapshot,
+		writes:   map[string]write[[]byte]{},
+	}
+}
+
+func (t *transaction) Put(key, val []byte) error {
+	if t.closed {
+		return TxnClosed
+	}
+	t.writes[string(key)] = write[[]byte]{value: append([]byte{}, val...)}
+	return nil
+}
+
+func (t *transaction) Get(key []byte) ([]byte, error) {
+	if t.closed {
+		return nil, TxnClosed
+	}
+	if w, ok := t.writes[string(key)]; ok {
+		if w.deleted {
+			return nil, api.NotFound
+		}
+		return append([]byte{}, w.value...), nil
+	}
+	return t.store.read(string(key), t.snapshot)
+}
+
+func (t *transaction) Delete(key []byte) error {
+	if t.closed {
+		return TxnClosed
+	}
+	t.writes[string(key)] = write[[]byte]{deleted: true}
+	return nil
+}
+
+func (t *transaction) Abort() error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.store.end(t.snapshot)
+	return nil
+}
+
+func (t *transaction) Commit() error {
+	if t.closed {
+		return TxnClosed
+	}
+	t.closed = true
+	return t.store.commit(t.snapshot, t.writes)
+}
@@ -0,0 +1,355 @@
+// Package kvtest checks that an api.TransactionalKvStorage behaves as the trie expects.
+package kvtest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+)
+
+// Run runs the conformance tests against the storages returned by open,
+// every test opens a new empty storage. The storages must be safe for concurrent use,
+// and a transaction must read a snapshot of the storage taken when it began.
+// Concurrent commits of the same key may either fail or overwrite each other.
+// Storages implementing api.IterableKvStorage are checked to list their keys too.
+func Run(t *testing.T, open func(t *testing.T) api.TransactionalKvStorage) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, kv api.TransactionalKvStorage)
+	}{
+		{"NotFound", testNotFound},
+		{"ReadYourWrites", testReadYourWrites},
+		{"Commit", testCommit},
+		{"Abort", testAbort},
+		{"Atomicity", testAtomicity},
+		{"ConcurrentAtomicity", testConcurrentAtomicity},
+		{"ConcurrentWriters", testConcurrentWriters},
+		{"Isolation", testIsolation},
+		{"DisjointWrites", testDisjointWrites},
+		{"ConflictingWrites", testConflictingWrites},
+		{"Keys", testKeys},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, open(t))
+		})
+	}
+}
+
+func begin(t *testing.T, kv api.TransactionalKvStorage) api.KvStorageTransaction {
+	t.Helper()
+	txn, err := kv.Transaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return txn
+}
+
+// commit writes pairs of keys and values in one transaction, a nil value deletes the key
+func commit(t *testing.T, kv api.TransactionalKvStorage, pairs ...[]byte) {
+	t.Helper()
+	txn := begin(t, kv)
+	for i := 0; i < len(pairs); i += 2 {
+		var err error
+		if pairs[i+1] == nil {
+			err = txn.Delete(pairs[i])
+		} else {
+			err = txn.Put(pairs[i], pairs[i+1])
+		}
+		if err != nil {
+			txn.Abort()
+			t.Fatal(err)
+		}
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expect checks the value of key read by txn, a nil value expects api.NotFound
+func expect(t *testing.T, txn api.KvStorageTransaction, key, value []byte) {
+	t.Helper()
+	got, err := txn.Get(key)
+	if value == nil {
+		if !errors.Is(err, api.NotFound) {
+			t.Fatalf("key %q: expected api.NotFound, got %q, %v", key, got, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("key %q: %s", key, err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Fatalf("key %q: expected %q, got %q", key, value, got)
+	}
+}
+
+// expectCommitted checks the committed values of pairs of keys and values
+func expectCommitted(t *testing.T, kv api.TransactionalKvStorage, pairs ...[]byte) {
+	t.Helper()
+	txn := begin(t, kv)
+	defer txn.Abort()
+	for i := 0; i < len(pairs); i += 2 {
+		expect(t, txn, pairs[i], pairs[i+1])
+	}
+}
+
+func testNotFound(t *testing.T, kv api.TransactionalKvStorage) {
+	expectCommitted(t, kv, []byte("missing"), nil)
+	commit(t, kv, []byte("key"), []byte("value"))
+	commit(t, kv, []byte("key"), nil)
+	expectCommitted(t, kv, []byte("key"), nil)
+	// deleting a missing key is not an error
+	commit(t, kv, []byte("missing"), nil)
+}
+
+func testReadYourWrites(t *testing.T, kv api.TransactionalKvStorage) {
+	commit(t, kv, []byte("a"), []byte("1"), []byte("b"), []byte("2"))
+	txn := begin(t, kv)
+	defer txn.Abort()
+	value := []byte("3")
+	txn.Put([]byte("a"), value)
+	// the storage keeps its own copy of the value
+	value[0] = 'x'
+	txn.Delete([]byte("b"))
+	txn.Put([]byte("c"), []byte("4"))
+	expect(t, txn, []byte("a"), []byte("3"))
+	expect(t, txn, []byte("b"), nil)
+	expect(t, txn, []byte("c"), []byte("4"))
+	txn.Put([]byte("b"), []byte("5"))
+	expect(t, txn, []byte("b"), []byte("5"))
+}
+
+func testCommit(t *testing.T, kv api.TransactionalKvStorage) {
+	commit(t, kv, []byte("a"), []byte("1"), []byte("b"), []byte("2"))
+	commit(t, kv, []byte("a"), []byte("3"), []byte("b"), nil, []byte("c"), []byte("4"))
+	expectCommitted(t, kv, []byte("a"), []byte("3"), []byte("b"), nil, []byte("c"), []byte("4"))
+
+	// a returned value is not changed by later writes
+	txn := begin(t, kv)
+	got, _ := txn.Get([]byte("a"))
+	txn.Abort()
+	commit(t, kv, []byte("a"), []byte("4"))
+	if !bytes.Equal(got, []byte("3")) {
+		t.Fatalf("returned value changed to %q", got)
+	}
+}
+
+func testAbort(t *testing.T, kv api.TransactionalKvStorage) {
+	commit(t, kv, []byte("a"), []byte("1"), []byte("b"), []byte("2"))
+	txn := begin(t, kv)
+	txn.Put([]byte("a"), []byte("3"))
+	txn.Delete([]byte("b"))
+	txn.Put([]byte("c"), []byte("4"))
+	if err := txn.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	expectCommitted(t, kv, []byte("a"), []byte("1"), []byte("b"), []byte("2"), []byte("c"), nil)
+}
+
+func testAtomicity(t *testing.T, kv api.TransactionalKvStorage) {
+	commit(t, kv, []byte("deleted"), []byte("1"))
+	txn := begin(t, kv)
+	for i := 0; i < 100; i++ {
+		txn.Put([]byte(fmt.Sprint("key", i)), []byte(fmt.Sprint(i)))
+	}
+	txn.Delete([]byte("deleted"))
+
+	// nothing is visible before the commit
+	other := begin(t, kv)
+	for i := 0; i < 100; i++ {
+		expect(t, other, []byte(fmt.Sprint("key", i)), nil)
+	}
+	expect(t, other, []byte("deleted"), []byte("1"))
+	other.Abort()
+
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	other = begin(t, kv)
+	defer other.Abort()
+	for i := 0; i < 100; i++ {
+		expect(t, other, []byte(fmt.Sprint("key", i)), []byte(fmt.Sprint(i)))
+	}
+	expect(t, other, []byte("deleted"), nil)
+}
+
+// testConcurrentAtomicity checks that readers never see a commit partially applied
+func testConcurrentAtomicity(t *testing.T, kv api.TransactionalKvStorage) {
+	keys := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	commit(t, kv, keys[0], []byte("0"), keys[1], []byte("0"), keys[2], []byte("0"))
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				txn, err := kv.Transaction()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				var values [][]byte
+				for _, key := range keys {
+					val, err := txn.Get(key)
+					if err != nil {
+						t.Error(err)
+					}
+					values = append(values, val)
+				}
+				txn.Abort()
+				if !bytes.Equal(values[0], values[1]) || !bytes.Equal(values[0], values[2]) {
+					t.Errorf("partial commit read: %q", values)
+					return
+				}
+			}
+		}()
+	}
+	for i := 1; i <= 100; i++ {
+		val := []byte(fmt.Sprint(i))
+		commit(t, kv, keys[0], val, keys[1], val, keys[2], val)
+	}
+	close(done)
+	wg.Wait()
+}
+
+// testConcurrentWriters checks that concurrent transactions on disjoint keys all commit
+func testConcurrentWriters(t *testing.T, kv api.TransactionalKvStorage) {
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				txn, err := kv.Transaction()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				key := []byte(fmt.Sprint("writer", w, "-", i))
+				if _, err := txn.Get(key); !errors.Is(err, api.NotFound) {
+					t.Errorf("key %q: expected api.NotFound, got %v", key, err)
+				}
+				if err := txn.Put(key, key); err != nil {
+					txn.Abort()
+					t.Error(err)
+					return
+				}
+				if err := txn.Commit(); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	txn := begin(t, kv)
+	defer txn.Abort()
+	for w := 0; w < 8; w++ {
+		for i := 0; i < 50; i++ {
+			key := []byte(fmt.Sprint("writer", w, "-", i))
+			expect(t, txn, key, key)
+		}
+	}
+}
+
+func testIsolation(t *testing.T, kv api.TransactionalKvStorage) {
+	commit(t, kv, []byte("a"), []byte("1"), []byte("b"), []byte("1"))
+	reader := begin(t, kv)
+	defer reader.Abort()
+	expect(t, reader, []byte("a"), []byte("1"))
+
+	// uncommitted writes are not visible
+	writer := begin(t, kv)
+	writer.Put([]byte("a"), []byte("2"))
+	writer.Delete([]byte("b"))
+	writer.Put([]byte("c"), []byte("2"))
+	expect(t, reader, []byte("a"), []byte("1"))
+	expect(t, reader, []byte("b"), []byte("1"))
+	expect(t, reader, []byte("c"), nil)
+
+	// nor are writes committed after the transaction began
+	if err := writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, reader, []byte("a"), []byte("1"))
+	expect(t, reader, []byte("b"), []byte("1"))
+	expect(t, reader, []byte("c"), nil)
+	expectCommitted(t, kv, []byte("a"), []byte("2"), []byte("b"), nil, []byte("c"), []byte("2"))
+}
+
+func testDisjointWrites(t *testing.T, kv api.TransactionalKvStorage) {
+	first := begin(t, kv)
+	second := begin(t, kv)
+	first.Put([]byte("a"), []byte("1"))
+	second.Put([]byte("b"), []byte("2"))
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	expectCommitted(t, kv, []byte("a"), []byte("1"), []byte("b"), []byte("2"))
+}
+
+func testConflictingWrites(t *testing.T, kv api.TransactionalKvStorage) {
+	commit(t, kv, []byte("a"), []byte("0"), []byte("b"), []byte("0"))
+	first := begin(t, kv)
+	second := begin(t, kv)
+	for _, txn := range []api.KvStorageTransaction{first, second} {
+		// read before write, as the trie does
+		expect(t, txn, []byte("a"), []byte("0"))
+	}
+	first.Put([]byte("a"), []byte("1"))
+	first.Put([]byte("b"), []byte("1"))
+	second.Put([]byte("a"), []byte("2"))
+	second.Put([]byte("b"), []byte("2"))
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	// the second commit may fail or win, but never mixes with the first
+	expected := []byte("2")
+	if err := second.Commit(); err != nil {
+		expected = []byte("1")
+	}
+	expectCommitted(t, kv, []byte("a"), expected, []byte("b"), expected)
+}
+
+func testKeys(t *testing.T, kv api.TransactionalKvStorage) {
+	iterable, ok := kv.(api.IterableKvStorage)
+	if !ok {
+		t.Skip("storage cannot enumerate keys")
+	}
+	commit(t, kv, []byte("b"), []byte("1"), []byte("a"), []byte("1"), []byte("d"), []byte("1"), []byte("c"), []byte("1"))
+	commit(t, kv, []byte("c"), nil)
+	var all [][]byte
+	var start []byte
+	for {
+		keys, err := iterable.Keys(start, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) > 2 {
+			t.Fatalf("%d keys returned for a limit of 2", len(keys))
+		}
+		if len(keys) == 0 {
+			break
+		}
+		all = append(all, keys...)
+		start = append(append([]byte{}, keys[len(keys)-1]...), 0)
+	}
+	if string(bytes.Join(all, []byte(","))) != "a,b,d" {
+		t.Fatalf("keys %q", all)
+	}
+}
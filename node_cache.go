@@ -0,0 +1,69 @@
+package mpt
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+const defaultNodeCacheSize = 4096
+
+// nodeCache keeps the last decoded nodes by hash, shared by the batches of a trie.
+// A stored node never changes under its hash, so a cached node stays valid
+// as long as it is reachable. The batches change the nodes they load,
+// so the cache only hands out and keeps copies.
+type nodeCache struct {
+	mu    sync.Mutex
+	size  int
+	lru   *list.List
+	nodes map[string]*list.Element
+}
+
+type cachedNode struct {
+	hash string
+	node internal.Node
+}
+
+// newNodeCache creates a cache of up to size nodes, nil if size is not positive
+func newNodeCache(size int) *nodeCache {
+	if size <= 0 {
+		return nil
+	}
+	return &nodeCache{size: size, lru: list.New(), nodes: map[string]*list.Element{}}
+}
+
+// get returns a copy of the node of hash h, or nil if it is not cached
+func (c *nodeCache) get(h []byte) internal.Node {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.nodes[string(h)]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(e)
+	return internal.CopyNode(e.Value.(*cachedNode).node)
+}
+
+// add caches a copy of node, which was loaded from hash h
+func (c *nodeCache) add(h []byte, node internal.Node) {
+	if c == nil {
+		return
+	}
+	node = internal.CopyNode(node)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.nodes[string(h)]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.nodes[string(h)] = c.lru.PushFront(&cachedNode{hash: string(h), node: node})
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.nodes, oldest.Value.(*cachedNode).hash)
+	}
+}
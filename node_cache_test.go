@@ -0,0 +1,63 @@
+package mpt
+
+import (
+	"crypto"
+	"fmt"
+	"testing"
+)
+
+func TestTrieNodeCache(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	batch, _ := trie.Batch(nil)
+	for i := 0; i < 100; i++ {
+		batch.Put([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	trie = New(crypto.SHA256.New, kv, []byte("test_root"))
+	for i := 0; i < 100; i++ {
+		if _, err := trie.Get([]byte(fmt.Sprintf("key%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the cached nodes are not read again from kv storage
+	stored := map[string][]byte{}
+	for k, v := range kv.kv {
+		stored[k] = v
+		if len(k) == crypto.SHA256.Size() {
+			delete(kv.kv, k)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := trie.Get([]byte(fmt.Sprintf("key%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kv.kv = stored
+
+	// the changes of a batch do not reach the cached nodes
+	batch, _ = trie.Batch(nil)
+	batch.Put([]byte("key1"), []byte("changed"))
+	batch.Delete([]byte("key2"))
+	batch.Abort()
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		if v, err := trie.Get([]byte(key)); err != nil || string(v) != fmt.Sprintf("value%d", i) {
+			t.Fatalf("get %s: %s %v", key, v, err)
+		}
+	}
+
+	// the cache is bounded
+	small := New(crypto.SHA256.New, kv, []byte("test_root"), WithNodeCache(8))
+	for i := 0; i < 100; i++ {
+		if _, err := small.Get([]byte(fmt.Sprintf("key%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := small.nodes.lru.Len(); n != 8 {
+		t.Fatalf("%d cached nodes", n)
+	}
+}
@@ -0,0 +1,245 @@
+package mpt
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// refCountPrefix is prepended to a node hash to form the key of its reference count
+var refCountPrefix = []byte("mpt-ref-")
+
+// nodeStore keeps reference counts of the nodes stored in kv storage.
+// A node is referenced once by every stored parent node and by every root pointing to it,
+// nodes are content addressed so the same node can be shared by several keys and roots.
+// A node is only physically deleted when its count drops to zero.
+//
+// Nodes written before reference counting was introduced have no count,
+// they are counted the first time they are referenced and are never deleted before that.
+type nodeStore struct {
+	kv     api.KvStorageTransaction
+	hasher *internal.Hasher
+	counts map[string]uint64
+	guard  *pruneGuard
+	// the encodings of the nodes serialized by an encoder
+	encoded map[internal.Node][]byte
+}
+
+func newNodeStore(kv api.KvStorageTransaction, hasher *internal.Hasher) *nodeStore {
+	return &nodeStore{
+		kv:     kv,
+		hasher: hasher,
+		counts: map[string]uint64{},
+	}
+}
+
+// ref adds a reference to node, writing it and referencing its children
+// if it is not stored yet. The hash of node is returned.
+func (s *nodeStore) ref(node internal.Node) ([]byte, error) {
+	if n, ok := node.(*internal.HashNode); ok {
+		return []byte(*n), s.refHash([]byte(*n))
+	}
+	// a clean node which is already stored is not encoded again,
+	// it may be stored in an older encoding under the hash it was loaded from
+	if h := node.CachedHash(); h != nil && !internal.IsDirty(node) && !s.hasher.Embedded(h) {
+		stored, err := s.stored(h)
+		if err != nil {
+			return nil, err
+		}
+		if stored {
+			return h, s.refHash(h)
+		}
+	}
+	data, ok := s.encoded[node]
+	if !ok || internal.IsDirty(node) {
+		var err error
+		data, err = node.Serialize(s.hasher)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	h := node.CachedHash()
+	if s.hasher.Embedded(h) {
+		// a root small enough to be embedded is still stored under its hash
+		h, err = internal.Hash(s.hasher, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.guard.keep(h)
+	count, err := s.count(h)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		if err := s.kv.Put(h, data); err != nil {
+			return nil, err
+		}
+		if err := s.refChildren(node); err != nil {
+			return nil, err
+		}
+	}
+	s.counts[string(h)] = count + 1
+	return h, nil
+}
+
+// refHash adds a reference to a node which is already in kv storage
+func (s *nodeStore) refHash(h []byte) error {
+	s.guard.keep(h)
+	count, err := s.count(h)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		// the node has never been counted, count its children now
+		node, err := s.load(h)
+		if err != nil {
+			return err
+		}
+		if err := s.refChildren(node); err != nil {
+			return err
+		}
+	}
+	s.counts[string(h)] = count + 1
+	return nil
+}
+
+func (s *nodeStore) refChildren(node internal.Node) error {
+	return s.hasher.StoredChildren(node, func(child internal.Node) error {
+		_, err := s.ref(child)
+		return err
+	})
+}
+
+// unref removes a reference to the node of hash h,
+// the node is deleted with its unreferenced children when the count reaches zero.
+func (s *nodeStore) unref(h []byte) error {
+	count, err := s.count(h)
+	if err != nil {
+		return err
+	}
+	switch count {
+	case 0:
+		// the node is not counted, so it may still be referred elsewhere
+		return nil
+	case 1:
+		node, err := s.load(h)
+		if err != nil {
+			return err
+		}
+		if err := s.kv.Delete(h); err != nil {
+			return err
+		}
+		s.counts[string(h)] = 0
+		children, err := childHashes(s.hasher, node)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if err := s.unref(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		s.counts[string(h)] = count - 1
+		return nil
+	}
+}
+
+// replaceRoot points rootKey to newRoot, which must be referenced already,
+// and releases oldRoot. A nil newRoot is the empty trie.
+func (s *nodeStore) replaceRoot(rootKey, oldRoot, newRoot []byte, archive bool) error {
+	var err error
+	if len(newRoot) == 0 {
+		err = s.kv.Delete(rootKey)
+	} else {
+		err = s.kv.Put(rootKey, newRoot)
+	}
+	if err != nil {
+		return err
+	}
+	// in archive mode the replaced root keeps its reference,
+	// so none of its nodes is deleted
+	if len(oldRoot) > 0 && !archive {
+		return s.unref(oldRoot)
+	}
+	return nil
+}
+
+func (s *nodeStore) count(h []byte) (uint64, error) {
+	if count, ok := s.counts[string(h)]; ok {
+		return count, nil
+	}
+	data, err := s.kv.Get(refCountKey(h))
+	if err != nil && !errors.Is(err, api.NotFound) {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, errors.New("[Node Store] invalid reference count")
+	}
+	return count, nil
+}
+
+// stored reports whether the node of hash h is in kv storage,
+// a node serialized but never written, or deleted by this store, is not
+func (s *nodeStore) stored(h []byte) (bool, error) {
+	count, err := s.count(h)
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+	if _, ok := s.counts[string(h)]; ok {
+		return false, nil
+	}
+	// the node may be stored without a count
+	_, err = s.kv.Get(h)
+	if errors.Is(err, api.NotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *nodeStore) load(h []byte) (internal.Node, error) {
+	return loadNode(s.kv, s.hasher, h, nil)
+}
+
+// flush writes the changed reference counts to kv storage
+func (s *nodeStore) flush() error {
+	// the counts are written in hash order, so a commit always writes the same sequence
+	hashes := make([]string, 0, len(s.counts))
+	for h := range s.counts {
+		hashes = append(hashes, h)
+	}
+	sort.Strings(hashes)
+	for _, h := range hashes {
+		count := s.counts[h]
+		key := refCountKey([]byte(h))
+		if count == 0 {
+			if err := s.kv.Delete(key); err != nil {
+				return err
+			}
+			continue
+		}
+		buf := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(buf, count)
+		if err := s.kv.Put(key, buf[:n]); err != nil {
+			return err
+		}
+	}
+	s.counts = map[string]uint64{}
+	return nil
+}
+
+func refCountKey(h []byte) []byte {
+	key := make([]byte, 0, len(refCountPrefix)+len(h))
+	key = append(key, refCountPrefix...)
+	return append(key, h...)
+}
@@ -0,0 +1,174 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"math/rand"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// reachable collects the hashes of the stored nodes under the node of hash h
+func reachable(t *testing.T, kv *MapKv, h []byte, ret map[string]bool) {
+	if ret[string(h)] {
+		return
+	}
+	ret[string(h)] = true
+	node, err := internal.DeserializeNode(internal.NewHasher(crypto.SHA256.New(), internal.ProtoCodec{}), kv.kv[string(h)])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the values encoded in their parent are not hash nodes
+	switch n := node.(type) {
+	case *internal.FullNode:
+		for _, child := range n.Children {
+			if hn, ok := child.(*internal.HashNode); ok {
+				reachable(t, kv, []byte(*hn), ret)
+			}
+		}
+	case *internal.ShortNode:
+		if hn, ok := n.Value.(*internal.HashNode); ok {
+			reachable(t, kv, []byte(*hn), ret)
+		}
+	}
+}
+
+// checkStoredNodes checks that the kv storage holds exactly the nodes of the given roots
+func checkStoredNodes(t *testing.T, kv *MapKv, rootKeys ...string) {
+	expected := map[string]bool{}
+	for _, rootKey := range rootKeys {
+		expected[rootKey] = true
+		if rootHash, ok := kv.kv[rootKey]; ok {
+			reachable(t, kv, rootHash, expected)
+		}
+	}
+	for k := range kv.kv {
+		if isMetadataKey(k, rootKeys) {
+			continue
+		}
+		if bytes.HasPrefix([]byte(k), refCountPrefix) {
+			if !expected[k[len(refCountPrefix):]] {
+				t.Fatalf("reference count of unreachable node %x", k[len(refCountPrefix):])
+			}
+			continue
+		}
+		if !expected[k] {
+			t.Fatalf("unreachable node %x is not deleted", k)
+		}
+	}
+	for k := range expected {
+		if _, ok := kv.kv[k]; !ok && !contains(rootKeys, k) {
+			t.Fatalf("reachable node %x is deleted", k)
+		}
+	}
+}
+
+// isMetadataKey reports whether key is a history, codec or preimage record of the tries
+func isMetadataKey(key string, rootKeys []string) bool {
+	for _, rootKey := range rootKeys {
+		if bytes.HasPrefix([]byte(key), append([]byte(rootKey), historySuffix...)) {
+			return true
+		}
+		if bytes.HasPrefix([]byte(key), append([]byte(rootKey), preimageSuffix...)) {
+			return true
+		}
+		if key == string(formatKey([]byte(rootKey))) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTrieSharedValueNodes(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	trie.Put([]byte("a"), []byte("same_value"))
+	trie.Put([]byte("b"), []byte("same_value"))
+	trie.Put([]byte("c"), []byte("same_value"))
+
+	if err := trie.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := trie.Put([]byte("b"), []byte("other_value")); err != nil {
+		t.Fatal(err)
+	}
+	val, err := trie.Get([]byte("c"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(val, []byte("same_value")) {
+		t.Fatal("value not equal")
+	}
+	checkStoredNodes(t, kv, "test_root")
+
+	trie.Delete([]byte("b"))
+	trie.Delete([]byte("c"))
+	for k := range kv.kv {
+		if !isMetadataKey(k, []string{"test_root"}) {
+			t.Fatalf("record %x left in an empty trie", k)
+		}
+	}
+}
+
+func TestTrieRefCountRandom(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	// two tries sharing the same storage share identical nodes
+	tries := []*Trie{
+		New(crypto.SHA256.New, kv, []byte("root_a")),
+		New(crypto.SHA256.New, kv, []byte("root_b")),
+	}
+	r := rand.New(rand.NewSource(1))
+	expected := []map[string]string{{}, {}}
+	for round := 0; round < 100; round++ {
+		i := r.Intn(len(tries))
+		batch, err := tries[i].Batch(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for op := 0; op < 5; op++ {
+			key := string([]byte{byte('a' + r.Intn(3)), byte('a' + r.Intn(3))})[:1+r.Intn(2)]
+			if _, ok := expected[i][key]; ok && r.Intn(2) == 0 {
+				if err := batch.Delete([]byte(key)); err != nil {
+					t.Fatal(err)
+				}
+				delete(expected[i], key)
+				continue
+			}
+			value := string([]byte{byte('0' + r.Intn(3))})
+			if err := batch.Put([]byte(key), []byte(value)); err != nil {
+				t.Fatal(err)
+			}
+			expected[i][key] = value
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		checkStoredNodes(t, kv, "root_a", "root_b")
+
+		for i, trie := range tries {
+			for k, v := range expected[i] {
+				val, err := trie.Get([]byte(k))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(val) != v {
+					t.Fatalf("key %q: value not equal", k)
+				}
+			}
+		}
+	}
+}
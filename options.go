@@ -0,0 +1,86 @@
+package mpt
+
+// Option configures a Trie created by New.
+type Option func(*Trie)
+
+// WithArchive keeps the nodes of replaced roots when a batch is committed,
+// so every committed root stays readable with Trie.At.
+func WithArchive() Option {
+	return func(t *Trie) {
+		t.archive = true
+	}
+}
+
+// WithPruneBatchSize sets the number of keys swept
+// in a single transaction by Trie.Prune.
+func WithPruneBatchSize(size int) Option {
+	return func(t *Trie) {
+		if size > 0 {
+			t.pruneBatchSize = size
+		}
+	}
+}
+
+// WithEthereum builds the trie like Ethereum does: the keys are split in nibbles,
+// the nodes are RLP encoded and the nodes shorter than 32 bytes are embedded in their parent.
+// Along with Keccak-256 the root hashes match the Ethereum ones, see NewEthereum.
+// Putting an empty value deletes the key, like in Ethereum.
+func WithEthereum() Option {
+	return func(t *Trie) {
+		t.format.hexary = true
+		t.format.codec = RLPCodec
+	}
+}
+
+// WithInlineValues encodes the values of at most maxSize bytes in their parent node
+// instead of storing them under their own hash, which saves a kv entry and a read per value.
+// The size is recorded with the codec, a trie must be opened with the size of its first commit.
+// It has no effect on RLPCodec, which always encodes the values in their parent.
+func WithInlineValues(maxSize int) Option {
+	return func(t *Trie) {
+		if maxSize > 0 {
+			t.format.inlineValues = maxSize
+		}
+	}
+}
+
+// WithCommitWorkers sets the number of goroutines serializing and hashing
+// the changed nodes of a batch on commit, GOMAXPROCS by default.
+// The nodes are written to the transaction in the same order whatever the number.
+func WithCommitWorkers(workers int) Option {
+	return func(t *Trie) {
+		if workers > 0 {
+			t.commitWorkers = workers
+		}
+	}
+}
+
+// WithNodeCache sets the number of decoded nodes cached by the trie and shared by its batches,
+// 4096 by default. A size of 0 disables the cache.
+func WithNodeCache(size int) Option {
+	return func(t *Trie) {
+		if size >= 0 {
+			t.nodeCacheSize = size
+		}
+	}
+}
+
+// WithBatchMemory limits the memory held by the nodes of a batch to about limit bytes.
+// Beyond it the batch writes its changed subtrees to its transaction and keeps their hash only,
+// they are loaded back if they change again. The root hash does not depend on the limit.
+// By default the nodes of a batch stay in memory until commit.
+func WithBatchMemory(limit int) Option {
+	return func(t *Trie) {
+		if limit > 0 {
+			t.batchMemory = limit
+		}
+	}
+}
+
+// WithNodeCodec sets the encoding of the nodes among ProtobufCodec, the default, BinaryCodec and RLPCodec.
+// A trie must be opened with the codec of its first commit, otherwise its batches fail with CodecMismatch.
+func WithNodeCodec(codec NodeCodec) Option {
+	return func(t *Trie) {
+		t.format.codec = codec
+	}
+}
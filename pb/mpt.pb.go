@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.25.0-devel
+// 	protoc-gen-go v1.31.0
 // 	protoc        v3.14.0
 // source: mpt.proto
 
@@ -29,6 +29,7 @@ type PersistNode struct {
 	//	*PersistNode_Full
 	//	*PersistNode_Short
 	//	*PersistNode_Value
+	//	*PersistNode_Sparse
 	Content isPersistNode_Content `protobuf_oneof:"Content"`
 }
 
@@ -92,6 +93,13 @@ func (x *PersistNode) GetValue() []byte {
 	return nil
 }
 
+func (x *PersistNode) GetSparse() *PersistSparseFullNode {
+	if x, ok := x.GetContent().(*PersistNode_Sparse); ok {
+		return x.Sparse
+	}
+	return nil
+}
+
 type isPersistNode_Content interface {
 	isPersistNode_Content()
 }
@@ -108,12 +116,19 @@ type PersistNode_Value struct {
 	Value []byte `protobuf:"bytes,3,opt,name=value,proto3,oneof"`
 }
 
+type PersistNode_Sparse struct {
+	Sparse *PersistSparseFullNode `protobuf:"bytes,4,opt,name=sparse,proto3,oneof"`
+}
+
 func (*PersistNode_Full) isPersistNode_Content() {}
 
 func (*PersistNode_Short) isPersistNode_Content() {}
 
 func (*PersistNode_Value) isPersistNode_Content() {}
 
+func (*PersistNode_Sparse) isPersistNode_Content() {}
+
+// the layout of full nodes before PersistSparseFullNode, still decoded
 type PersistFullNode struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -161,6 +176,72 @@ func (x *PersistFullNode) GetChildren() [][]byte {
 	return nil
 }
 
+// a full node holding only its non-empty children,
+// bit i of bitmap (bitmap[i/8] >> (i%8)) is set when child i is present
+type PersistSparseFullNode struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Bitmap   []byte   `protobuf:"bytes,1,opt,name=bitmap,proto3" json:"bitmap,omitempty"`
+	Children [][]byte `protobuf:"bytes,2,rep,name=children,proto3" json:"children,omitempty"`
+	// the children holding a value instead of the hash of a value node, in the same bit order
+	Inline []byte `protobuf:"bytes,3,opt,name=inline,proto3" json:"inline,omitempty"`
+}
+
+func (x *PersistSparseFullNode) Reset() {
+	*x = PersistSparseFullNode{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mpt_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PersistSparseFullNode) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PersistSparseFullNode) ProtoMessage() {}
+
+func (x *PersistSparseFullNode) ProtoReflect() protoreflect.Message {
+	mi := &file_mpt_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PersistSparseFullNode.ProtoReflect.Descriptor instead.
+func (*PersistSparseFullNode) Descriptor() ([]byte, []int) {
+	return file_mpt_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PersistSparseFullNode) GetBitmap() []byte {
+	if x != nil {
+		return x.Bitmap
+	}
+	return nil
+}
+
+func (x *PersistSparseFullNode) GetChildren() [][]byte {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+func (x *PersistSparseFullNode) GetInline() []byte {
+	if x != nil {
+		return x.Inline
+	}
+	return nil
+}
+
 type PersistShortNode struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -168,12 +249,14 @@ type PersistShortNode struct {
 
 	Key   []byte `protobuf:"bytes,1,opt,name=Key,proto3" json:"Key,omitempty"`
 	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	// value holds the value itself instead of the hash of a value node
+	Inline bool `protobuf:"varint,3,opt,name=inline,proto3" json:"inline,omitempty"`
 }
 
 func (x *PersistShortNode) Reset() {
 	*x = PersistShortNode{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_mpt_proto_msgTypes[2]
+		mi := &file_mpt_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -186,7 +269,7 @@ func (x *PersistShortNode) String() string {
 func (*PersistShortNode) ProtoMessage() {}
 
 func (x *PersistShortNode) ProtoReflect() protoreflect.Message {
-	mi := &file_mpt_proto_msgTypes[2]
+	mi := &file_mpt_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -199,7 +282,7 @@ func (x *PersistShortNode) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PersistShortNode.ProtoReflect.Descriptor instead.
 func (*PersistShortNode) Descriptor() ([]byte, []int) {
-	return file_mpt_proto_rawDescGZIP(), []int{2}
+	return file_mpt_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *PersistShortNode) GetKey() []byte {
@@ -216,6 +299,13 @@ func (x *PersistShortNode) GetValue() []byte {
 	return nil
 }
 
+func (x *PersistShortNode) GetInline() bool {
+	if x != nil {
+		return x.Inline
+	}
+	return false
+}
+
 type PersistTrie struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -227,7 +317,7 @@ type PersistTrie struct {
 func (x *PersistTrie) Reset() {
 	*x = PersistTrie{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_mpt_proto_msgTypes[3]
+		mi := &file_mpt_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -240,7 +330,7 @@ func (x *PersistTrie) String() string {
 func (*PersistTrie) ProtoMessage() {}
 
 func (x *PersistTrie) ProtoReflect() protoreflect.Message {
-	mi := &file_mpt_proto_msgTypes[3]
+	mi := &file_mpt_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -253,7 +343,7 @@ func (x *PersistTrie) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PersistTrie.ProtoReflect.Descriptor instead.
 func (*PersistTrie) Descriptor() ([]byte, []int) {
-	return file_mpt_proto_rawDescGZIP(), []int{3}
+	return file_mpt_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *PersistTrie) GetPairs() []*PersistKV {
@@ -275,7 +365,7 @@ type PersistKV struct {
 func (x *PersistKV) Reset() {
 	*x = PersistKV{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_mpt_proto_msgTypes[4]
+		mi := &file_mpt_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -288,7 +378,7 @@ func (x *PersistKV) String() string {
 func (*PersistKV) ProtoMessage() {}
 
 func (x *PersistKV) ProtoReflect() protoreflect.Message {
-	mi := &file_mpt_proto_msgTypes[4]
+	mi := &file_mpt_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -301,7 +391,7 @@ func (x *PersistKV) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PersistKV.ProtoReflect.Descriptor instead.
 func (*PersistKV) Descriptor() ([]byte, []int) {
-	return file_mpt_proto_rawDescGZIP(), []int{4}
+	return file_mpt_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *PersistKV) GetKey() []byte {
@@ -318,11 +408,82 @@ func (x *PersistKV) GetValue() []byte {
 	return nil
 }
 
+type PersistRootRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version    uint64 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Root       []byte `protobuf:"bytes,2,opt,name=root,proto3" json:"root,omitempty"`
+	Metadata   []byte `protobuf:"bytes,3,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	RollbackTo uint64 `protobuf:"varint,4,opt,name=rollback_to,json=rollbackTo,proto3" json:"rollback_to,omitempty"`
+}
+
+func (x *PersistRootRecord) Reset() {
+	*x = PersistRootRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_mpt_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PersistRootRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PersistRootRecord) ProtoMessage() {}
+
+func (x *PersistRootRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_mpt_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PersistRootRecord.ProtoReflect.Descriptor instead.
+func (*PersistRootRecord) Descriptor() ([]byte, []int) {
+	return file_mpt_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PersistRootRecord) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *PersistRootRecord) GetRoot() []byte {
+	if x != nil {
+		return x.Root
+	}
+	return nil
+}
+
+func (x *PersistRootRecord) GetMetadata() []byte {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+func (x *PersistRootRecord) GetRollbackTo() uint64 {
+	if x != nil {
+		return x.RollbackTo
+	}
+	return 0
+}
+
 var File_mpt_proto protoreflect.FileDescriptor
 
 var file_mpt_proto_rawDesc = []byte{
 	0x0a, 0x09, 0x6d, 0x70, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x02, 0x70, 0x62, 0x22,
-	0x89, 0x01, 0x0a, 0x0b, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x4e, 0x6f, 0x64, 0x65, 0x12,
+	0xbe, 0x01, 0x0a, 0x0b, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x4e, 0x6f, 0x64, 0x65, 0x12,
 	0x29, 0x0a, 0x04, 0x66, 0x75, 0x6c, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e,
 	0x70, 0x62, 0x2e, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x46, 0x75, 0x6c, 0x6c, 0x4e, 0x6f,
 	0x64, 0x65, 0x48, 0x00, 0x52, 0x04, 0x66, 0x75, 0x6c, 0x6c, 0x12, 0x2c, 0x0a, 0x05, 0x73, 0x68,
@@ -330,21 +491,41 @@ var file_mpt_proto_rawDesc = []byte{
 	0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x53, 0x68, 0x6f, 0x72, 0x74, 0x4e, 0x6f, 0x64, 0x65, 0x48,
 	0x00, 0x52, 0x05, 0x73, 0x68, 0x6f, 0x72, 0x74, 0x12, 0x16, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75,
 	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
-	0x42, 0x09, 0x0a, 0x07, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x22, 0x2d, 0x0a, 0x0f, 0x50,
-	0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x46, 0x75, 0x6c, 0x6c, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x1a,
-	0x0a, 0x08, 0x43, 0x68, 0x69, 0x6c, 0x64, 0x72, 0x65, 0x6e, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0c,
-	0x52, 0x08, 0x43, 0x68, 0x69, 0x6c, 0x64, 0x72, 0x65, 0x6e, 0x22, 0x3a, 0x0a, 0x10, 0x50, 0x65,
-	0x72, 0x73, 0x69, 0x73, 0x74, 0x53, 0x68, 0x6f, 0x72, 0x74, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x10,
-	0x0a, 0x03, 0x4b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x4b, 0x65, 0x79,
-	0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
-	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x22, 0x32, 0x0a, 0x0b, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73,
-	0x74, 0x54, 0x72, 0x69, 0x65, 0x12, 0x23, 0x0a, 0x05, 0x70, 0x61, 0x69, 0x72, 0x73, 0x18, 0x01,
-	0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73,
-	0x74, 0x4b, 0x56, 0x52, 0x05, 0x70, 0x61, 0x69, 0x72, 0x73, 0x22, 0x33, 0x0a, 0x09, 0x50, 0x65,
-	0x72, 0x73, 0x69, 0x73, 0x74, 0x4b, 0x56, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x42,
-	0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x12, 0x33, 0x0a, 0x06, 0x73, 0x70, 0x61, 0x72, 0x73, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x19, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x53, 0x70, 0x61,
+	0x72, 0x73, 0x65, 0x46, 0x75, 0x6c, 0x6c, 0x4e, 0x6f, 0x64, 0x65, 0x48, 0x00, 0x52, 0x06, 0x73,
+	0x70, 0x61, 0x72, 0x73, 0x65, 0x42, 0x09, 0x0a, 0x07, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74,
+	0x22, 0x2d, 0x0a, 0x0f, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x46, 0x75, 0x6c, 0x6c, 0x4e,
+	0x6f, 0x64, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x43, 0x68, 0x69, 0x6c, 0x64, 0x72, 0x65, 0x6e, 0x18,
+	0x01, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x08, 0x43, 0x68, 0x69, 0x6c, 0x64, 0x72, 0x65, 0x6e, 0x22,
+	0x63, 0x0a, 0x15, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x53, 0x70, 0x61, 0x72, 0x73, 0x65,
+	0x46, 0x75, 0x6c, 0x6c, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x62, 0x69, 0x74, 0x6d,
+	0x61, 0x70, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x62, 0x69, 0x74, 0x6d, 0x61, 0x70,
+	0x12, 0x1a, 0x0a, 0x08, 0x63, 0x68, 0x69, 0x6c, 0x64, 0x72, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x03,
+	0x28, 0x0c, 0x52, 0x08, 0x63, 0x68, 0x69, 0x6c, 0x64, 0x72, 0x65, 0x6e, 0x12, 0x16, 0x0a, 0x06,
+	0x69, 0x6e, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x69, 0x6e,
+	0x6c, 0x69, 0x6e, 0x65, 0x22, 0x52, 0x0a, 0x10, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x53,
+	0x68, 0x6f, 0x72, 0x74, 0x4e, 0x6f, 0x64, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x4b, 0x65, 0x79, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x4b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x69, 0x6e, 0x6c, 0x69, 0x6e, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x06, 0x69, 0x6e, 0x6c, 0x69, 0x6e, 0x65, 0x22, 0x32, 0x0a, 0x0b, 0x50, 0x65, 0x72, 0x73,
+	0x69, 0x73, 0x74, 0x54, 0x72, 0x69, 0x65, 0x12, 0x23, 0x0a, 0x05, 0x70, 0x61, 0x69, 0x72, 0x73,
+	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0d, 0x2e, 0x70, 0x62, 0x2e, 0x50, 0x65, 0x72, 0x73,
+	0x69, 0x73, 0x74, 0x4b, 0x56, 0x52, 0x05, 0x70, 0x61, 0x69, 0x72, 0x73, 0x22, 0x33, 0x0a, 0x09,
+	0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x4b, 0x56, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x22, 0x7e, 0x0a, 0x11, 0x50, 0x65, 0x72, 0x73, 0x69, 0x73, 0x74, 0x52, 0x6f, 0x6f, 0x74,
+	0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
+	0x12, 0x12, 0x0a, 0x04, 0x72, 0x6f, 0x6f, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04,
+	0x72, 0x6f, 0x6f, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
+	0x12, 0x1f, 0x0a, 0x0b, 0x72, 0x6f, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x5f, 0x74, 0x6f, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x04, 0x52, 0x0a, 0x72, 0x6f, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x54,
+	0x6f, 0x42, 0x06, 0x5a, 0x04, 0x2e, 0x3b, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
 }
 
 var (
@@ -359,23 +540,26 @@ func file_mpt_proto_rawDescGZIP() []byte {
 	return file_mpt_proto_rawDescData
 }
 
-var file_mpt_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_mpt_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
 var file_mpt_proto_goTypes = []interface{}{
-	(*PersistNode)(nil),      // 0: pb.PersistNode
-	(*PersistFullNode)(nil),  // 1: pb.PersistFullNode
-	(*PersistShortNode)(nil), // 2: pb.PersistShortNode
-	(*PersistTrie)(nil),      // 3: pb.PersistTrie
-	(*PersistKV)(nil),        // 4: pb.PersistKV
+	(*PersistNode)(nil),           // 0: pb.PersistNode
+	(*PersistFullNode)(nil),       // 1: pb.PersistFullNode
+	(*PersistSparseFullNode)(nil), // 2: pb.PersistSparseFullNode
+	(*PersistShortNode)(nil),      // 3: pb.PersistShortNode
+	(*PersistTrie)(nil),           // 4: pb.PersistTrie
+	(*PersistKV)(nil),             // 5: pb.PersistKV
+	(*PersistRootRecord)(nil),     // 6: pb.PersistRootRecord
 }
 var file_mpt_proto_depIdxs = []int32{
 	1, // 0: pb.PersistNode.full:type_name -> pb.PersistFullNode
-	2, // 1: pb.PersistNode.short:type_name -> pb.PersistShortNode
-	4, // 2: pb.PersistTrie.pairs:type_name -> pb.PersistKV
-	3, // [3:3] is the sub-list for method output_type
-	3, // [3:3] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	3, // 1: pb.PersistNode.short:type_name -> pb.PersistShortNode
+	2, // 2: pb.PersistNode.sparse:type_name -> pb.PersistSparseFullNode
+	5, // 3: pb.PersistTrie.pairs:type_name -> pb.PersistKV
+	4, // [4:4] is the sub-list for method output_type
+	4, // [4:4] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_mpt_proto_init() }
@@ -409,7 +593,7 @@ func file_mpt_proto_init() {
 			}
 		}
 		file_mpt_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PersistShortNode); i {
+			switch v := v.(*PersistSparseFullNode); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -421,7 +605,7 @@ func file_mpt_proto_init() {
 			}
 		}
 		file_mpt_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*PersistTrie); i {
+			switch v := v.(*PersistShortNode); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -433,6 +617,18 @@ func file_mpt_proto_init() {
 			}
 		}
 		file_mpt_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PersistTrie); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_mpt_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*PersistKV); i {
 			case 0:
 				return &v.state
@@ -444,11 +640,24 @@ func file_mpt_proto_init() {
 				return nil
 			}
 		}
+		file_mpt_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PersistRootRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	file_mpt_proto_msgTypes[0].OneofWrappers = []interface{}{
 		(*PersistNode_Full)(nil),
 		(*PersistNode_Short)(nil),
 		(*PersistNode_Value)(nil),
+		(*PersistNode_Sparse)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -456,7 +665,7 @@ func file_mpt_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_mpt_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   7,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
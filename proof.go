@@ -0,0 +1,209 @@
+package mpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// Prove collects the serialized nodes on the path from the root to the value of key.
+// The proof is ordered from the root downwards and can be checked by VerifyProof.
+func (b *Batch) Prove(key []byte) ([][]byte, error) {
+	proof, found, err := b.provePath(b.path(key))
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, KeyNotFound
+	}
+	return proof, nil
+}
+
+// ProveAbsence collects the serialized nodes on the path from the root to the point
+// where key diverges from the trie. It can be checked by VerifyAbsenceProof.
+func (b *Batch) ProveAbsence(key []byte) ([][]byte, error) {
+	proof, found, err := b.provePath(b.path(key))
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return nil, fmt.Errorf("[Trie Proof] cannot prove absence: %w", KeyExists)
+	}
+	return proof, nil
+}
+
+// provePath walks down key like Batch.get does and serializes every stored node on the path,
+// the nodes embedded in their parent are part of the parent's encoding.
+// found reports whether the walk ends at the value of key.
+func (b *Batch) provePath(key []byte) ([][]byte, bool, error) {
+	if b.closed {
+		return nil, false, BatchClosed
+	}
+	var proof [][]byte
+	hasher := b.hasher()
+	node := b.root
+	// the root is always stored
+	stored := true
+	prefixLen := 0
+	for {
+		if node == nil {
+			return proof, false, nil
+		}
+		if n, ok := node.(*internal.HashNode); ok {
+			loadedNode, err := b.resolve(n, key[:prefixLen])
+			if err != nil {
+				return nil, false, err
+			}
+			node = loadedNode
+		}
+		if stored {
+			data, err := node.Serialize(hasher)
+			if err != nil {
+				return nil, false, err
+			}
+			proof = append(proof, data)
+		}
+		parent, slot := node, 0
+		switch n := node.(type) {
+		case *internal.FullNode:
+			if prefixLen == len(key) {
+				slot = 256
+			} else {
+				slot = int(key[prefixLen])
+				prefixLen++
+			}
+			node = n.Children[slot]
+		case *internal.ShortNode:
+			if len(key)-prefixLen < len(n.Key) || !bytes.Equal(n.Key, key[prefixLen:prefixLen+len(n.Key)]) {
+				return proof, false, nil
+			}
+			node = n.Value
+			prefixLen += len(n.Key)
+		case *internal.ValueNode:
+			return proof, prefixLen == len(key), nil
+		default:
+			return nil, false, errors.New("[Trie Proof] Unknown node type")
+		}
+		if node != nil {
+			var err error
+			if stored, err = hasher.Stored(parent, slot, node); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+}
+
+// VerifyProof checks a proof generated by Prove against the root hash,
+// and returns the value of key if the proof is valid.
+// Every node of the proof is rehashed, so no storage is needed.
+// The options must select the same format as the trie, see WithEthereum.
+func VerifyProof(hf HasherFactory, rootHash, key []byte, proof [][]byte, opts ...Option) ([]byte, error) {
+	value, found, err := verifyPath(proofFormat(hf, opts), rootHash, key, proof)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("[Trie Proof] key is absent: %w", InvalidProof)
+	}
+	return value, nil
+}
+
+// VerifyAbsenceProof checks a proof generated by ProveAbsence against the root hash,
+// a nil error means key does not exist in the trie.
+func VerifyAbsenceProof(hf HasherFactory, rootHash, key []byte, proof [][]byte, opts ...Option) error {
+	_, found, err := verifyPath(proofFormat(hf, opts), rootHash, key, proof)
+	if err != nil {
+		return err
+	}
+	if found {
+		return fmt.Errorf("[Trie Proof] key is present: %w", InvalidProof)
+	}
+	return nil
+}
+
+// proofFormat returns the format of a trie created with opts
+func proofFormat(hf HasherFactory, opts []Option) format {
+	t := &Trie{format: format{hFac: hf, codec: ProtobufCodec}}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t.format
+}
+
+// verifyPath replays the walk of provePath on the proof,
+// the walk must end exactly at the last node of the proof.
+func verifyPath(f format, rootHash, key []byte, proof [][]byte) ([]byte, bool, error) {
+	// the empty trie has no root and proves absence of every key
+	if len(rootHash) == 0 {
+		if len(proof) != 0 {
+			return nil, false, fmt.Errorf("[Trie Proof] proof for an empty trie: %w", InvalidProof)
+		}
+		return nil, false, nil
+	}
+	hasher := f.hasher()
+	key = f.path(key)
+	prefixLen := 0
+	// i is the index of the proof node holding node,
+	// embedded children are walked without moving to the next proof node
+	i := -1
+	var node internal.Node = (*internal.HashNode)(&rootHash)
+	for {
+		if hn, ok := node.(*internal.HashNode); ok {
+			i++
+			if i == len(proof) {
+				return nil, false, fmt.Errorf("[Trie Proof] proof is incomplete: %w", InvalidProof)
+			}
+			h, err := internal.Hash(hasher, proof[i])
+			if err != nil {
+				return nil, false, err
+			}
+			if !bytes.Equal(h, []byte(*hn)) {
+				return nil, false, fmt.Errorf("[Trie Proof] node %d: %w: %w", i, HashMismatch, InvalidProof)
+			}
+			node, err = internal.DeserializeNode(hasher, proof[i])
+			if err != nil {
+				return nil, false, fmt.Errorf("[Trie Proof] node %d: %w: %w", i, err, InvalidProof)
+			}
+		}
+		last := i == len(proof)-1
+		var next internal.Node
+		switch n := node.(type) {
+		case *internal.FullNode:
+			// a missing child, including the slot 256 terminator, means the key diverges
+			if prefixLen == len(key) {
+				next = n.Children[256]
+			} else {
+				next = n.Children[key[prefixLen]]
+				prefixLen++
+			}
+		case *internal.ShortNode:
+			if len(key)-prefixLen < len(n.Key) || !bytes.Equal(n.Key, key[prefixLen:prefixLen+len(n.Key)]) {
+				if !last {
+					return nil, false, fmt.Errorf("[Trie Proof] node %d: key diverges before the end of proof: %w", i, InvalidProof)
+				}
+				return nil, false, nil
+			}
+			next = n.Value
+			prefixLen += len(n.Key)
+		case *internal.ValueNode:
+			if !last {
+				return nil, false, fmt.Errorf("[Trie Proof] node %d: unexpected value node: %w", i, InvalidProof)
+			}
+			if prefixLen != len(key) {
+				return nil, false, nil
+			}
+			return n.Value, true, nil
+		default:
+			return nil, false, fmt.Errorf("[Trie Proof] node %d: unknown node type: %w", i, InvalidProof)
+		}
+		if next == nil {
+			if !last {
+				return nil, false, fmt.Errorf("[Trie Proof] node %d: key diverges before the end of proof: %w", i, InvalidProof)
+			}
+			return nil, false, nil
+		}
+		node = next
+	}
+}
@@ -0,0 +1,150 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"testing"
+)
+
+var proofCases = map[string][]byte{
+	"":        []byte("empty"),
+	"a":       []byte("a_value"),
+	"ab":      []byte("ab_value"),
+	"abc":     []byte("abc_value"),
+	"abd":     []byte("abd_value"),
+	"b":       []byte("b_value"),
+	"bcdefgh": []byte("bcdefgh_value"),
+	"test1":   []byte("same_value"),
+	"test2":   []byte("same_value"),
+}
+
+func newProofTrie(t *testing.T) *Trie {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	batch, _ := trie.Batch(nil)
+	for k, v := range proofCases {
+		if err := batch.Put([]byte(k), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	return trie
+}
+
+func TestTrieProve(t *testing.T) {
+	trie := newProofTrie(t)
+	rootHash, err := trie.RootHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range proofCases {
+		proof, err := trie.Prove([]byte(k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := VerifyProof(crypto.SHA256.New, rootHash, []byte(k), proof)
+		if err != nil {
+			t.Fatalf("key %q: %s", k, err)
+		}
+		if !bytes.Equal(val, v) {
+			t.Fatalf("key %q: value not equal", k)
+		}
+	}
+
+	if _, err := trie.Prove([]byte("abe")); err != KeyNotFound {
+		t.Fatal("proof generated for missing key")
+	}
+}
+
+func TestVerifyProofRejectsTampering(t *testing.T) {
+	trie := newProofTrie(t)
+	rootHash, _ := trie.RootHash()
+	proof, err := trie.Prove([]byte("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// proof for another key
+	if _, err := VerifyProof(crypto.SHA256.New, rootHash, []byte("abd"), proof); !errors.Is(err, InvalidProof) {
+		t.Fatal("proof accepted for another key")
+	}
+
+	// wrong root
+	otherRoot := crypto.SHA256.New().Sum([]byte("other"))
+	if _, err := VerifyProof(crypto.SHA256.New, otherRoot, []byte("abc"), proof); !errors.Is(err, InvalidProof) {
+		t.Fatal("proof accepted for another root")
+	}
+
+	// truncated proof
+	if _, err := VerifyProof(crypto.SHA256.New, rootHash, []byte("abc"), proof[:len(proof)-1]); !errors.Is(err, InvalidProof) {
+		t.Fatal("truncated proof accepted")
+	}
+
+	// modified value
+	tampered := make([][]byte, len(proof))
+	copy(tampered, proof)
+	last := append([]byte{}, proof[len(proof)-1]...)
+	last[len(last)-1] ^= 0xff
+	tampered[len(tampered)-1] = last
+	if _, err := VerifyProof(crypto.SHA256.New, rootHash, []byte("abc"), tampered); !errors.Is(err, InvalidProof) {
+		t.Fatal("tampered proof accepted")
+	}
+}
+
+func TestTrieProveAbsence(t *testing.T) {
+	trie := newProofTrie(t)
+	if err := trie.Delete([]byte("abd")); err != nil {
+		t.Fatal(err)
+	}
+	rootHash, _ := trie.RootHash()
+
+	// diverging short node key, nil child, missing terminator, value before the key ends
+	for _, k := range []string{"abd", "abcd", "bc", "c", "tes", "test", "test3", "bcdefghi"} {
+		proof, err := trie.ProveAbsence([]byte(k))
+		if err != nil {
+			t.Fatalf("key %q: %s", k, err)
+		}
+		if err := VerifyAbsenceProof(crypto.SHA256.New, rootHash, []byte(k), proof); err != nil {
+			t.Fatalf("key %q: %s", k, err)
+		}
+		if _, err := VerifyProof(crypto.SHA256.New, rootHash, []byte(k), proof); !errors.Is(err, InvalidProof) {
+			t.Fatalf("key %q: absence proof accepted as inclusion proof", k)
+		}
+	}
+
+	if _, err := trie.ProveAbsence([]byte("abc")); !errors.Is(err, KeyExists) {
+		t.Fatalf("expected KeyExists, got %v", err)
+	}
+
+	// an inclusion proof does not prove absence
+	proof, _ := trie.Prove([]byte("abc"))
+	if err := VerifyAbsenceProof(crypto.SHA256.New, rootHash, []byte("abc"), proof); !errors.Is(err, InvalidProof) {
+		t.Fatal("inclusion proof accepted as absence proof")
+	}
+
+	// an absence proof of one key does not prove absence of another
+	proof, _ = trie.ProveAbsence([]byte("c"))
+	if err := VerifyAbsenceProof(crypto.SHA256.New, rootHash, []byte("abc"), proof); !errors.Is(err, InvalidProof) {
+		t.Fatal("absence proof accepted for existing key")
+	}
+}
+
+func TestTrieProveAbsenceEmpty(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"))
+	proof, err := trie.ProveAbsence([]byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAbsenceProof(crypto.SHA256.New, nil, []byte("a"), proof); err != nil {
+		t.Fatal(err)
+	}
+}
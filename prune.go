@@ -0,0 +1,239 @@
+package mpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+const defaultPruneBatchSize = 1024
+
+// pruneGuard protects the nodes referenced by commits running
+// while a prune is sweeping, so they are not deleted under them.
+type pruneGuard struct {
+	mu     sync.Mutex
+	active bool
+	live   map[string]struct{}
+}
+
+func (g *pruneGuard) keep(h []byte) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	if g.active {
+		g.live[string(h)] = struct{}{}
+	}
+	g.mu.Unlock()
+}
+
+// Prune deletes every stored node which is not reachable from keepRoots
+// or from the current root of the trie. It marks the reachable nodes first
+// in one snapshot of the storage, then sweeps the keys of the storage,
+// which must implement api.IterableKvStorage, in transactions of bounded size.
+// The trie can be used meanwhile, nodes referenced by concurrent commits through this trie are kept.
+// The snapshot and each page of the sweep wait for the running batch like a batch does,
+// so Prune must not be called while the calling goroutine holds an open batch of the trie.
+//
+// Other tries sharing the storage share its nodes too,
+// their roots must be part of keepRoots.
+func (t *Trie) Prune(keepRoots [][]byte) error {
+	if t.readOnly {
+		return ReadOnly
+	}
+	kv, ok := t.kv.(api.IterableKvStorage)
+	if !ok {
+		return fmt.Errorf("[Trie Prune] %w", NotIterable)
+	}
+
+	// the snapshot is taken between two batches, so every commit
+	// is either in the snapshot or keeps the nodes it references in the guard
+	t.writer.Lock()
+	t.guard.mu.Lock()
+	if t.guard.active {
+		t.guard.mu.Unlock()
+		t.writer.Unlock()
+		return fmt.Errorf("[Trie Prune] %w", PruneRunning)
+	}
+	t.guard.active = true
+	t.guard.live = map[string]struct{}{}
+	t.guard.mu.Unlock()
+	txn, err := t.kv.Transaction()
+	t.writer.Unlock()
+	defer func() {
+		t.guard.mu.Lock()
+		t.guard.active = false
+		t.guard.live = nil
+		t.guard.mu.Unlock()
+	}()
+
+	if err != nil {
+		return err
+	}
+	marked, err := t.mark(txn, keepRoots)
+	txn.Abort()
+	if err != nil {
+		return err
+	}
+	return t.sweep(kv, marked)
+}
+
+// mark collects the hashes of the nodes reachable from roots
+// and from the root of the trie in txn
+func (t *Trie) mark(txn api.KvStorageTransaction, roots [][]byte) (map[string]struct{}, error) {
+	rootHash, err := txn.Get(t.rootKey)
+	if err != nil && !errors.Is(err, api.NotFound) {
+		return nil, err
+	}
+	roots = append([][]byte{rootHash}, roots...)
+	marked := map[string]struct{}{}
+	var pending [][]byte
+	for _, root := range roots {
+		if len(root) > 0 {
+			pending = append(pending, root)
+		}
+	}
+	batch := &Batch{kv: txn, format: t.format}
+	for len(pending) > 0 {
+		h := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if _, ok := marked[string(h)]; ok {
+			continue
+		}
+		hn := internal.HashNode(h)
+		node, err := batch.resolve(&hn, nil)
+		if err != nil {
+			return nil, err
+		}
+		marked[string(h)] = struct{}{}
+		children, err := childHashes(batch.hasher(), node)
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			if _, ok := marked[string(child)]; !ok {
+				pending = append(pending, child)
+			}
+		}
+	}
+	return marked, nil
+}
+
+// sweep deletes the stored nodes which are not marked, page by page.
+// The reference counts of marked nodes drop by the references of the deleted parents.
+func (t *Trie) sweep(kv api.IterableKvStorage, marked map[string]struct{}) error {
+	var start []byte
+	for {
+		keys, err := kv.Keys(start, t.pruneBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		err = t.sweepKeys(keys, marked)
+		if err != nil {
+			return err
+		}
+		last := keys[len(keys)-1]
+		start = append(append([]byte{}, last...), 0)
+	}
+}
+
+func (t *Trie) sweepKeys(keys [][]byte, marked map[string]struct{}) error {
+	// a page is swept between two batches, so no batch reads the counts
+	// from a snapshot older than the page, and the nodes referenced by the batches
+	// committed since the mark are in the live set of the guard
+	t.writer.Lock()
+	defer t.writer.Unlock()
+	t.guard.mu.Lock()
+	defer t.guard.mu.Unlock()
+
+	txn, err := t.kv.Transaction()
+	if err != nil {
+		return err
+	}
+	hasher := t.hasher()
+	store := newNodeStore(txn, hasher)
+	for _, key := range keys {
+		h := key
+		isCount := bytes.HasPrefix(key, refCountPrefix)
+		if isCount {
+			h = key[len(refCountPrefix):]
+		}
+		if _, ok := marked[string(h)]; ok {
+			continue
+		}
+		if _, ok := t.guard.live[string(h)]; ok {
+			continue
+		}
+		if isCount {
+			// the count of a node which is not reachable anymore
+			store.counts[string(h)] = 0
+			continue
+		}
+
+		// only nodes are swept, they are stored under the hash of their content
+		data, err := txn.Get(key)
+		if err != nil && !errors.Is(err, api.NotFound) {
+			txn.Abort()
+			return err
+		}
+		if len(data) == 0 {
+			continue
+		}
+		dataHash, err := internal.Hash(hasher, data)
+		if err != nil {
+			txn.Abort()
+			return err
+		}
+		if !bytes.Equal(dataHash, key) {
+			continue
+		}
+		node, err := internal.DeserializeNode(hasher, data)
+		if err != nil {
+			continue
+		}
+		children, err := childHashes(hasher, node)
+		if err != nil {
+			continue
+		}
+		for _, child := range children {
+			if _, ok := marked[string(child)]; !ok {
+				continue
+			}
+			count, err := store.count(child)
+			if err != nil {
+				txn.Abort()
+				return err
+			}
+			if count > 1 {
+				store.counts[string(child)] = count - 1
+			}
+		}
+		if err := txn.Delete(key); err != nil {
+			txn.Abort()
+			return err
+		}
+		store.counts[string(h)] = 0
+	}
+	if err := store.flush(); err != nil {
+		txn.Abort()
+		return err
+	}
+	return txn.Commit()
+}
+
+// childHashes returns the hashes of the stored children of a loaded node
+func childHashes(hasher *internal.Hasher, node internal.Node) ([][]byte, error) {
+	var ret [][]byte
+	err := hasher.StoredChildren(node, func(child internal.Node) error {
+		ret = append(ret, child.CachedHash())
+		return nil
+	})
+	return ret, err
+}
@@ -0,0 +1,124 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+func TestTriePrune(t *testing.T) {
+	kv := &MapKv{
+		kv: map[string][]byte{},
+	}
+	trie := New(crypto.SHA256.New, kv, []byte("test_root"), WithArchive(), WithPruneBatchSize(3))
+	r := rand.New(rand.NewSource(1))
+	var roots [][]byte
+	var snapshots []map[string]string
+	expected := map[string]string{}
+	for i := 0; i < 10; i++ {
+		batch, _ := trie.Batch(nil)
+		for op := 0; op < 5; op++ {
+			key := fmt.Sprint("key", r.Intn(8))
+			if _, ok := expected[key]; ok && r.Intn(3) == 0 {
+				batch.Delete([]byte(key))
+				delete(expected, key)
+				continue
+			}
+			value := fmt.Sprint("value", r.Intn(3))
+			batch.Put([]byte(key), []byte(value))
+			expected[key] = value
+		}
+		if err := batch.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		rootHash, _ := trie.RootHash()
+		roots = append(roots, rootHash)
+		snapshot := map[string]string{}
+		for k, v := range expected {
+			snapshot[k] = v
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	if err := trie.Prune([][]byte{roots[6], roots[7]}); err != nil {
+		t.Fatal(err)
+	}
+
+	kept := map[string]bool{}
+	for _, i := range []int{6, 7, 9} {
+		kept[string(roots[i])] = true
+		view, err := trie.At(roots[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range snapshots[i] {
+			val, err := view.Get([]byte(k))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(val) != v {
+				t.Fatalf("version %d, key %q: value not equal", i, k)
+			}
+		}
+	}
+	for i, rootHash := range roots {
+		if kept[string(rootHash)] {
+			continue
+		}
+		if _, err := trie.At(rootHash); err == nil {
+			t.Fatalf("version %d is not pruned", i)
+		}
+	}
+
+	// every stored node is reachable, and counted once per reference
+	reachableNodes := map[string]bool{}
+	expectedCounts := map[string]uint64{}
+	for rootHash := range kept {
+		reachable(t, kv, []byte(rootHash), reachableNodes)
+		expectedCounts[rootHash]++
+	}
+	hasher := internal.NewHasher(crypto.SHA256.New(), internal.ProtoCodec{})
+	for h := range reachableNodes {
+		node, _ := internal.DeserializeNode(hasher, kv.kv[h])
+		children, _ := childHashes(hasher, node)
+		for _, child := range children {
+			expectedCounts[string(child)]++
+		}
+	}
+	for k, v := range kv.kv {
+		switch {
+		case k == "test_root" || isMetadataKey(k, []string{"test_root"}):
+		case bytes.HasPrefix([]byte(k), refCountPrefix):
+			h := k[len(refCountPrefix):]
+			count, _ := binary.Uvarint(v)
+			if count != expectedCounts[h] {
+				t.Fatalf("node %x: expected count %d, got %d", h, expectedCounts[h], count)
+			}
+		case !reachableNodes[k]:
+			t.Fatalf("unreachable node %x is not deleted", k)
+		}
+	}
+
+	// the trie keeps working after the prune
+	if err := trie.Put([]byte("key0"), []byte("after_prune")); err != nil {
+		t.Fatal(err)
+	}
+	val, _ := trie.Get([]byte("key0"))
+	if !bytes.Equal(val, []byte("after_prune")) {
+		t.Fatal("value not equal")
+	}
+}
+
+func TestTriePruneUnsupportedStorage(t *testing.T) {
+	var kv api.TransactionalKvStorage = &MapKv{kv: map[string][]byte{}}
+	trie := New(crypto.SHA256.New, struct{ api.TransactionalKvStorage }{kv}, []byte("test_root"))
+	if err := trie.Prune(nil); err == nil {
+		t.Fatal("prune without key enumeration")
+	}
+}
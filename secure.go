@@ -0,0 +1,222 @@
+package mpt
+
+import (
+	"errors"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// SecureTrie is a trie whose paths are the hashes of the keys,
+// so the keys cannot be chosen to build long branches.
+// The keys are hashed with the hasher of the trie, with NewEthereum it is the secure trie of Ethereum.
+// When preimages are kept, the original keys are stored along with the trie
+// and returned by the iterators, they are never deleted.
+type SecureTrie struct {
+	trie      *Trie
+	preimages bool
+}
+
+// NewSecureTrie wraps trie, keys put through the wrapper must not be put through trie itself.
+func NewSecureTrie(trie *Trie, preimages bool) *SecureTrie {
+	return &SecureTrie{trie: trie, preimages: preimages}
+}
+
+// Trie returns the wrapped trie, for the operations working on root hashes
+// such as History, Rollback, Diff or Prune.
+func (s *SecureTrie) Trie() *Trie { return s.trie }
+
+// SecureBatch is a Batch of a SecureTrie.
+type SecureBatch struct {
+	batch     *Batch
+	preimages bool
+}
+
+func (s *SecureTrie) Batch(txn api.KvStorageTransaction) (*SecureBatch, error) {
+	batch, err := s.trie.Batch(txn)
+	if err != nil {
+		return nil, err
+	}
+	return &SecureBatch{batch: batch, preimages: s.preimages}, nil
+}
+
+func (s *SecureTrie) Get(key []byte) ([]byte, error) {
+	return s.trie.Get(hashKey(s.trie.hFac, key))
+}
+
+func (s *SecureTrie) Put(key, value []byte) error {
+	batch, err := s.Batch(nil)
+	if err != nil {
+		return err
+	}
+	err = batch.Put(key, value)
+	if err != nil {
+		batch.Abort()
+		return err
+	}
+	return batch.Commit()
+}
+
+func (s *SecureTrie) Delete(key []byte) error {
+	return s.trie.Delete(hashKey(s.trie.hFac, key))
+}
+
+func (s *SecureTrie) Prove(key []byte) ([][]byte, error) {
+	return s.trie.Prove(hashKey(s.trie.hFac, key))
+}
+
+func (s *SecureTrie) ProveAbsence(key []byte) ([][]byte, error) {
+	return s.trie.ProveAbsence(hashKey(s.trie.hFac, key))
+}
+
+func (s *SecureTrie) RootHash() ([]byte, error) {
+	return s.trie.RootHash()
+}
+
+// Iterator returns an iterator over the committed keys in the order of their hashes,
+// the iterator must be closed to release its transaction.
+func (s *SecureTrie) Iterator() (*SecureIterator, error) {
+	batch, err := s.trie.reader(nil)
+	if err != nil {
+		return nil, err
+	}
+	it := (&SecureBatch{batch: batch, preimages: s.preimages}).Iterator()
+	it.it.owned = true
+	return it, nil
+}
+
+// Preimage returns the key of a hashed key, if preimages are kept.
+func (s *SecureTrie) Preimage(hashedKey []byte) ([]byte, error) {
+	txn, err := s.trie.kv.Transaction()
+	if err != nil {
+		return nil, err
+	}
+	defer txn.Abort()
+	return txn.Get(preimageKey(s.trie.rootKey, hashedKey))
+}
+
+func (b *SecureBatch) Get(key []byte) ([]byte, error) {
+	return b.batch.Get(hashKey(b.batch.hFac, key))
+}
+
+// Put stores value under the hash of key, and the preimage of the hash if preimages are kept.
+// No preimage is stored when an empty value deletes the key, see WithEthereum.
+func (b *SecureBatch) Put(key, value []byte) error {
+	hashedKey := hashKey(b.batch.hFac, key)
+	err := b.batch.Put(hashedKey, value)
+	if err != nil {
+		return err
+	}
+	if b.preimages && (len(value) > 0 || !b.batch.emptyDeletes()) {
+		return b.batch.kv.Put(preimageKey(b.batch.rootKey, hashedKey), key)
+	}
+	return nil
+}
+
+func (b *SecureBatch) Delete(key []byte) error {
+	return b.batch.Delete(hashKey(b.batch.hFac, key))
+}
+
+func (b *SecureBatch) Prove(key []byte) ([][]byte, error) {
+	return b.batch.Prove(hashKey(b.batch.hFac, key))
+}
+
+func (b *SecureBatch) ProveAbsence(key []byte) ([][]byte, error) {
+	return b.batch.ProveAbsence(hashKey(b.batch.hFac, key))
+}
+
+// Iterator returns an iterator over the keys in the order of their hashes,
+// including the uncommitted changes of the batch.
+func (b *SecureBatch) Iterator() *SecureIterator {
+	return &SecureIterator{it: b.batch.Iterator(nil), batch: b}
+}
+
+func (b *SecureBatch) Commit() error {
+	return b.batch.Commit()
+}
+
+func (b *SecureBatch) CommitWithMetadata(metadata []byte) error {
+	return b.batch.CommitWithMetadata(metadata)
+}
+
+func (b *SecureBatch) Abort() error {
+	return b.batch.Abort()
+}
+
+// SecureIterator walks the pairs of a SecureTrie in the order of the hashed keys.
+type SecureIterator struct {
+	it    *Iterator
+	batch *SecureBatch
+	key   []byte
+	err   error
+}
+
+// Next moves the iterator to the next pair and loads the preimage of its key,
+// it returns false when the iteration is done or an error occurs.
+func (it *SecureIterator) Next() bool {
+	it.key = nil
+	if it.err != nil || !it.it.Next() {
+		return false
+	}
+	if !it.batch.preimages {
+		return true
+	}
+	key, err := it.batch.batch.kv.Get(preimageKey(it.batch.batch.rootKey, it.it.Key()))
+	if err != nil {
+		if errors.Is(err, api.NotFound) {
+			err = &NodeError{Op: "preimage", Hash: it.it.Key(), Err: CorruptedNode}
+		}
+		it.err = err
+		return false
+	}
+	it.key = key
+	return true
+}
+
+// Key returns the key of the current pair, or nil if preimages are not kept.
+func (it *SecureIterator) Key() []byte { return it.key }
+
+// HashedKey returns the hash of the key of the current pair.
+func (it *SecureIterator) HashedKey() []byte { return it.it.Key() }
+
+// Value returns the value of the current pair.
+func (it *SecureIterator) Value() []byte { return it.it.Value() }
+
+// Err returns the error that stopped the iteration, if any.
+func (it *SecureIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.it.Err()
+}
+
+// Close releases the iterator, the transaction is aborted
+// if the iterator was created by SecureTrie.Iterator.
+func (it *SecureIterator) Close() error {
+	return it.it.Close()
+}
+
+// VerifySecureProof checks a proof generated by SecureTrie.Prove like VerifyProof.
+func VerifySecureProof(hf HasherFactory, rootHash, key []byte, proof [][]byte, opts ...Option) ([]byte, error) {
+	return VerifyProof(hf, rootHash, hashKey(hf, key), proof, opts...)
+}
+
+// VerifySecureAbsenceProof checks a proof generated by SecureTrie.ProveAbsence like VerifyAbsenceProof.
+func VerifySecureAbsenceProof(hf HasherFactory, rootHash, key []byte, proof [][]byte, opts ...Option) error {
+	return VerifyAbsenceProof(hf, rootHash, hashKey(hf, key), proof, opts...)
+}
+
+func hashKey(hf HasherFactory, key []byte) []byte {
+	// writing to a hash never fails
+	h, _ := internal.Hash(hf(), key)
+	return h
+}
+
+func preimageKey(rootKey, hashedKey []byte) []byte {
+	key := make([]byte, 0, len(rootKey)+len(preimageSuffix)+len(hashedKey))
+	key = append(key, rootKey...)
+	key = append(key, preimageSuffix...)
+	return append(key, hashedKey...)
+}
+
+var preimageSuffix = []byte("-preimage-")
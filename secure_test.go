@@ -0,0 +1,142 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestSecureTrie(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := NewSecureTrie(New(crypto.SHA256.New, kv, []byte("test_root")), true)
+	batch, _ := trie.Batch(nil)
+	var keys []string
+	for i := 0; i < 100; i++ {
+		// keys sharing long prefixes stay on short paths
+		key := fmt.Sprintf("%s%d", bytes.Repeat([]byte("a"), 64), i)
+		keys = append(keys, key)
+		if err := batch.Put([]byte(key), []byte(key+"_value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the same trie is built from the hashed keys
+	plain := New(crypto.SHA256.New, &MapKv{kv: map[string][]byte{}}, []byte("test_root"))
+	plainBatch, _ := plain.Batch(nil)
+	for _, key := range keys {
+		plainBatch.Put(hashKey(crypto.SHA256.New, []byte(key)), []byte(key+"_value"))
+	}
+	if err := plainBatch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	root, _ := trie.RootHash()
+	plainRoot, _ := plain.RootHash()
+	if !bytes.Equal(root, plainRoot) {
+		t.Fatalf("root %x, want %x", root, plainRoot)
+	}
+
+	for _, key := range keys {
+		value, err := trie.Get([]byte(key))
+		if err != nil || string(value) != key+"_value" {
+			t.Fatalf("get %s: %s %v", key, value, err)
+		}
+		proof, err := trie.Prove([]byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err = VerifySecureProof(crypto.SHA256.New, root, []byte(key), proof)
+		if err != nil || string(value) != key+"_value" {
+			t.Fatalf("verify %s: %s %v", key, value, err)
+		}
+	}
+	proof, err := trie.ProveAbsence([]byte("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecureAbsenceProof(crypto.SHA256.New, root, []byte("missing"), proof); err != nil {
+		t.Fatal(err)
+	}
+
+	// the iterator returns the preimages in the order of the hashes
+	it, err := trie.Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	var lastHash []byte
+	for it.Next() {
+		if !bytes.Equal(it.HashedKey(), hashKey(crypto.SHA256.New, it.Key())) || bytes.Compare(lastHash, it.HashedKey()) >= 0 {
+			t.Fatalf("key %s out of order", it.Key())
+		}
+		lastHash = it.HashedKey()
+		got = append(got, string(it.Key()))
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+	it.Close()
+	sort.Strings(got)
+	sort.Strings(keys)
+	if fmt.Sprint(got) != fmt.Sprint(keys) {
+		t.Fatal("iterated keys not equal")
+	}
+
+	if err := trie.Delete([]byte(keys[0])); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trie.Get([]byte(keys[0])); !errors.Is(err, KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+	checkStoredNodes(t, kv, "test_root")
+}
+
+func TestSecureTrieWithoutPreimages(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := NewSecureTrie(New(crypto.SHA256.New, kv, []byte("test_root")), false)
+	if err := trie.Put([]byte("key"), []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trie.Preimage(hashKey(crypto.SHA256.New, []byte("key"))); !errors.Is(err, KeyNotFound) {
+		t.Fatalf("expected KeyNotFound, got %v", err)
+	}
+	it, _ := trie.Iterator()
+	defer it.Close()
+	if !it.Next() || it.Key() != nil || string(it.Value()) != "value" {
+		t.Fatal("unexpected iterator pair")
+	}
+}
+
+func TestSecureTrieEthereumEmptyValue(t *testing.T) {
+	kv := &MapKv{kv: map[string][]byte{}}
+	trie := NewSecureTrie(NewEthereum(kv, []byte("test_root")), true)
+	batch, _ := trie.Batch(nil)
+	batch.Put([]byte("dog"), []byte("puppy"))
+	// the put of an empty value deletes the key, so no preimage is left for it
+	if err := batch.Put([]byte("horse"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trie.Preimage(hashKey(trie.Trie().hFac, []byte("horse"))); !errors.Is(err, KeyNotFound) {
+		t.Fatalf("expected no preimage, got %v", err)
+	}
+	if _, err := trie.Preimage(hashKey(trie.Trie().hFac, []byte("dog"))); err != nil {
+		t.Fatal(err)
+	}
+	it, _ := trie.Iterator()
+	defer it.Close()
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key()))
+	}
+	if it.Err() != nil || fmt.Sprint(keys) != "[dog]" {
+		t.Fatalf("keys %q: %v", keys, it.Err())
+	}
+}
@@ -0,0 +1,152 @@
+package mpt
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
+	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
+)
+
+// approximate memory held by the nodes of a batch
+var (
+	fullNodeSize  = int(unsafe.Sizeof(internal.FullNode{}))
+	shortNodeSize = int(unsafe.Sizeof(internal.ShortNode{}))
+	valueNodeSize = int(unsafe.Sizeof(internal.ValueNode{}))
+	hashNodeSize  = int(unsafe.Sizeof(internal.HashNode{}))
+)
+
+// memorySize estimates the memory held by a decoded node and its embedded children
+func memorySize(node internal.Node) int {
+	switch n := node.(type) {
+	case *internal.FullNode:
+		size := fullNodeSize
+		for _, child := range n.Children {
+			size += memorySize(child)
+		}
+		return size
+	case *internal.ShortNode:
+		return shortNodeSize + len(n.Key) + memorySize(n.Value)
+	case *internal.ValueNode:
+		return valueNodeSize + len(n.Value)
+	case *internal.HashNode:
+		return hashNodeSize + len(*n)
+	}
+	return 0
+}
+
+// fit spills the batch when its nodes exceed its memory limit
+func (t *Batch) fit() error {
+	if t.memoryLimit <= 0 || t.memory <= t.memoryLimit {
+		return nil
+	}
+	return t.spill()
+}
+
+// spill writes the changed subtrees under the root to the transaction
+// and replaces them with their hash, like the unchanged nodes loaded by the batch.
+// The spilled nodes are counted on commit, the ones replaced meanwhile are deleted then.
+func (t *Batch) spill() error {
+	hasher := t.hasher()
+	if err := t.spillChildren(t.root, hasher); err != nil {
+		return err
+	}
+	t.memory = memorySize(t.root)
+	return nil
+}
+
+func (t *Batch) spillChildren(node internal.Node, hasher *internal.Hasher) error {
+	switch n := node.(type) {
+	case *internal.FullNode:
+		for i, child := range n.Children {
+			spilled, err := t.spillChild(n, i, child, hasher)
+			if err != nil {
+				return err
+			}
+			n.Children[i] = spilled
+		}
+	case *internal.ShortNode:
+		spilled, err := t.spillChild(n, 0, n.Value, hasher)
+		if err != nil {
+			return err
+		}
+		n.Value = spilled
+	}
+	return nil
+}
+
+// spillChild returns the hash node replacing child at slot of parent,
+// or child itself when it is encoded in parent
+func (t *Batch) spillChild(parent internal.Node, slot int, child internal.Node, hasher *internal.Hasher) (internal.Node, error) {
+	switch child.(type) {
+	case nil, *internal.HashNode:
+		return child, nil
+	}
+	if hasher.Codec.InParent(parent, slot, child) {
+		return child, nil
+	}
+	// the children are replaced first, so child is encoded with their hashes
+	if err := t.spillChildren(child, hasher); err != nil {
+		return nil, err
+	}
+	changed := internal.IsDirty(child) || child.CachedHash() == nil
+	var data []byte
+	if changed {
+		var err error
+		data, err = child.Serialize(hasher)
+		if err != nil {
+			return nil, err
+		}
+	}
+	h := child.CachedHash()
+	if hasher.Embedded(h) {
+		return child, nil
+	}
+	if changed {
+		if err := t.spillNode(h, data); err != nil {
+			return nil, err
+		}
+	}
+	hn := internal.HashNode(h)
+	return &hn, nil
+}
+
+// spillNode writes a changed node unless it is stored already
+func (t *Batch) spillNode(h, data []byte) error {
+	if _, ok := t.spilled[string(h)]; ok {
+		return nil
+	}
+	_, err := t.kv.Get(h)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, api.NotFound) {
+		return err
+	}
+	// a running prune must not sweep the node before the batch is committed
+	t.guard.keep(h)
+	if err := t.kv.Put(h, data); err != nil {
+		return err
+	}
+	if t.spilled == nil {
+		t.spilled = map[string]struct{}{}
+	}
+	t.spilled[string(h)] = struct{}{}
+	return nil
+}
+
+// dropSpilled deletes the spilled nodes which are not referenced by the new root
+func (t *Batch) dropSpilled(store *nodeStore) error {
+	for h := range t.spilled {
+		count, err := store.count([]byte(h))
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			if err := t.kv.Delete([]byte(h)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestBatchMemoryLimit(t *testing.T) {
+	for _, opts := range [][]Option{
+		nil,
+		{WithNodeCodec(BinaryCodec), WithInlineValues(8)},
+		{WithEthereum()},
+	} {
+		var stores []*MapKv
+		var roots [][]byte
+		for _, limit := range []int{0, 64 << 10} {
+			kv := &MapKv{kv: map[string][]byte{}}
+			trie := New(crypto.SHA256.New, kv, []byte("test_root"), append(opts, WithBatchMemory(limit))...)
+			r := rand.New(rand.NewSource(1))
+			for round := 0; round < 3; round++ {
+				batch, _ := trie.Batch(nil)
+				for i := 0; i < 3000; i++ {
+					key := make([]byte, 1+r.Intn(3))
+					r.Read(key)
+					var err error
+					switch r.Intn(5) {
+					case 0:
+						err = batch.Delete(key)
+						if errors.Is(err, KeyNotFound) {
+							err = nil
+						}
+					case 1:
+						_, err = batch.Get(key)
+						if errors.Is(err, KeyNotFound) {
+							err = nil
+						}
+					default:
+						err = batch.Put(key, []byte(fmt.Sprint("value", r.Intn(100))))
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if limit > 0 && batch.memory > limit {
+						t.Fatalf("batch holds %d bytes, limit %d", batch.memory, limit)
+					}
+				}
+				if err := batch.Commit(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			root, _ := trie.RootHash()
+			stores, roots = append(stores, kv), append(roots, root)
+		}
+		if !bytes.Equal(roots[0], roots[1]) {
+			t.Fatalf("root %x without limit, %x with limit", roots[0], roots[1])
+		}
+		// the spilled nodes replaced before commit are not left behind
+		for k, v := range stores[0].kv {
+			if !isMetadataKey(k, []string{"test_root"}) && !bytes.Equal(stores[1].kv[k], v) {
+				t.Fatalf("stored key %x differs", k)
+			}
+		}
+		if len(stores[0].kv) != len(stores[1].kv) {
+			t.Fatalf("%d stored keys without limit, %d with limit", len(stores[0].kv), len(stores[1].kv))
+		}
+	}
+}
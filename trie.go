@@ -3,31 +3,85 @@ package mpt
 import (
 	"errors"
 	"hash"
+	"runtime"
+	"sync"
 
 	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
 	"github.com/MetaDataLab/go-MerklePatriciaTree/internal"
-	"github.com/MetaDataLab/go-MerklePatriciaTree/pb"
+	"golang.org/x/crypto/sha3"
 )
 
-var KeyNotFound = errors.New("key not found")
-
 type HasherFactory func() hash.Hash
 
+// Trie is safe for concurrent use. Get, Prove, ProveAbsence, Iterator and the read-only views
+// read the committed root of their storage transaction without locking,
+// while the batches, Put, Delete, Rollback and Import are serialized.
+// A reader sees a consistent root as long as the transactions of the storage
+// read a snapshot, or the trie is in archive mode.
 type Trie struct {
-	kv      api.TransactionalKvStorage
-	hFac    HasherFactory
+	kv api.TransactionalKvStorage
+	format
 	rootKey []byte
+	archive bool
+	// a read-only view of the trie at a fixed root, see Trie.At
+	readOnly bool
+	root     []byte
+	// protects the nodes of running commits from a concurrent prune
+	guard          *pruneGuard
+	pruneBatchSize int
+	commitWorkers  int
+	// serializes the batches
+	writer        *sync.Mutex
+	nodeCacheSize int
+	batchMemory   int
+	nodes         *nodeCache
 }
 
-func New(hf HasherFactory, kv api.TransactionalKvStorage, rootKey []byte) *Trie {
-	return &Trie{
-		kv:      kv,
-		hFac:    hf,
-		rootKey: rootKey,
+func New(hf HasherFactory, kv api.TransactionalKvStorage, rootKey []byte, opts ...Option) *Trie {
+	t := &Trie{
+		kv:             kv,
+		format:         format{hFac: hf, codec: ProtobufCodec},
+		rootKey:        rootKey,
+		guard:          &pruneGuard{},
+		writer:         &sync.Mutex{},
+		pruneBatchSize: defaultPruneBatchSize,
+		commitWorkers:  runtime.GOMAXPROCS(0),
+		nodeCacheSize:  defaultNodeCacheSize,
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
+	t.nodes = newNodeCache(t.nodeCacheSize)
+	return t
+}
+
+// NewEthereum creates a trie with Keccak-256 and WithEthereum,
+// so its root hashes are the ones of an Ethereum trie holding the same keys.
+func NewEthereum(kv api.TransactionalKvStorage, rootKey []byte, opts ...Option) *Trie {
+	return New(sha3.NewLegacyKeccak256, kv, rootKey, append([]Option{WithEthereum()}, opts...)...)
 }
 
+// Batch creates a batch on the current root of the trie, or on txn if it is not nil.
+// The batches of a trie are serialized: Batch waits until the previous batch
+// is committed or aborted, so a batch must always be closed.
+// The batches of a read-only view do not wait.
 func (t *Trie) Batch(txn api.KvStorageTransaction) (*Batch, error) {
+	if t.readOnly {
+		return t.reader(txn)
+	}
+	t.writer.Lock()
+	batch, err := t.reader(txn)
+	if err != nil {
+		t.writer.Unlock()
+		return nil, err
+	}
+	batch.release = t.writer.Unlock
+	return batch, nil
+}
+
+// reader creates a batch which does not wait for the other batches,
+// it must not be committed.
+func (t *Trie) reader(txn api.KvStorageTransaction) (*Batch, error) {
 	var err error
 	if txn == nil {
 		txn, err = t.kv.Transaction()
@@ -39,12 +93,23 @@ func (t *Trie) Batch(txn api.KvStorageTransaction) (*Batch, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Batch{
-		root:    root,
-		rootKey: t.rootKey,
-		hFac:    t.hFac,
-		kv:      txn,
-	}, nil
+	batch := &Batch{
+		root:     root,
+		rootKey:  t.rootKey,
+		format:   t.format,
+		kv:       txn,
+		archive:  t.archive,
+		readOnly: t.readOnly,
+		guard:    t.guard,
+		nodes:    t.nodes,
+
+		commitWorkers: t.commitWorkers,
+		memoryLimit:   t.batchMemory,
+	}
+	if root != nil {
+		batch.rootHash = root.CachedHash()
+	}
+	return batch, nil
 }
 
 func (t *Trie) Delete(key []byte) error {
@@ -54,18 +119,20 @@ func (t *Trie) Delete(key []byte) error {
 	}
 	err = batch.Delete(key)
 	if err != nil {
+		batch.Abort()
 		return err
 	}
 	return batch.Commit()
 }
 
 func (t *Trie) Get(key []byte) ([]byte, error) {
-	batch, err := t.Batch(nil)
+	batch, err := t.reader(nil)
 	if err != nil {
 		return nil, err
 	}
 	data, err := batch.Get(key)
 	if err != nil {
+		batch.Abort()
 		return nil, err
 	}
 	return data, batch.Abort()
@@ -78,12 +145,54 @@ func (t *Trie) Put(key, value []byte) error {
 	}
 	err = batch.Put(key, value)
 	if err != nil {
+		batch.Abort()
 		return err
 	}
 	return batch.Commit()
 }
 
+// Iterator returns an iterator over the committed keys greater than or equal to start,
+// the iterator must be closed to release its transaction.
+func (t *Trie) Iterator(start []byte) (*Iterator, error) {
+	batch, err := t.reader(nil)
+	if err != nil {
+		return nil, err
+	}
+	it := newIterator(batch, start, nil, false)
+	it.owned = true
+	return it, nil
+}
+
+func (t *Trie) Prove(key []byte) ([][]byte, error) {
+	batch, err := t.reader(nil)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := batch.Prove(key)
+	if err != nil {
+		batch.Abort()
+		return nil, err
+	}
+	return proof, batch.Abort()
+}
+
+func (t *Trie) ProveAbsence(key []byte) ([][]byte, error) {
+	batch, err := t.reader(nil)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := batch.ProveAbsence(key)
+	if err != nil {
+		batch.Abort()
+		return nil, err
+	}
+	return proof, batch.Abort()
+}
+
 func (t *Trie) RootHash() ([]byte, error) {
+	if t.readOnly {
+		return t.root, nil
+	}
 	txn, err := t.kv.Transaction()
 	if err != nil {
 		return nil, err
@@ -95,56 +204,25 @@ func (t *Trie) RootHash() ([]byte, error) {
 
 func (t *Trie) loadRoot(txn api.KvStorageTransaction) (internal.Node, error) {
 	var root internal.Node = nil
-	rootHash, err := txn.Get(t.rootKey)
-	if err != nil {
-		if err.Error() != KeyNotFound.Error() {
-			return nil, err
+	rootHash := t.root
+	if !t.readOnly {
+		var err error
+		rootHash, err = txn.Get(t.rootKey)
+		if err != nil {
+			if !errors.Is(err, api.NotFound) {
+				return nil, err
+			}
 		}
 	}
+	if err := checkFormat(txn, t.rootKey, t.format, len(rootHash) > 0); err != nil {
+		return nil, err
+	}
 	if len(rootHash) > 0 {
 		r := internal.HashNode(rootHash)
 		root = &r
 	}
 	if root != nil {
-		root.Serialize(t.hFac())
+		root.Serialize(t.hasher())
 	}
 	return root, nil
 }
-
-func (t *Trie) persist(node internal.Node, persistTrie *pb.PersistTrie) (internal.Node, error) {
-	if node != nil {
-		if n, ok := node.(*internal.HashNode); ok {
-			txn, err := t.kv.Transaction()
-			if err != nil {
-				return nil, err
-			}
-			data, err := txn.Get([]byte(*n))
-			if err != nil {
-				return node, err
-			}
-			newNode, err := internal.DeserializeNode(t.hFac(), data)
-			if err != nil {
-				return node, err
-			}
-			node = newNode
-		}
-		data, err := node.Serialize(t.hFac())
-		if err != nil {
-			return nil, err
-		}
-		persistKV := pb.PersistKV{
-			Key:   node.Hash(t.hFac()),
-			Value: data,
-		}
-		persistTrie.Pairs = append(persistTrie.Pairs, &persistKV)
-	}
-	switch n := node.(type) {
-	case *internal.FullNode:
-		for i := 0; i < len(n.Children); i++ {
-			t.persist(n.Children[i], persistTrie)
-		}
-	case *internal.ShortNode:
-		t.persist(n.Value, persistTrie)
-	}
-	return node, nil
-}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto"
 	"errors"
+	"sort"
 	"testing"
 
 	"github.com/MetaDataLab/go-MerklePatriciaTree/api"
@@ -19,6 +20,20 @@ func (m *MapKv) Transaction() (api.KvStorageTransaction, error) {
 	}, nil
 }
 
+func (m *MapKv) Keys(start []byte, limit int) ([][]byte, error) {
+	var keys [][]byte
+	for k := range m.kv {
+		if k >= string(start) {
+			keys = append(keys, []byte(k))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys, nil
+}
+
 type MapKvTransaction struct {
 	mapkv *MapKv
 }
@@ -28,7 +43,11 @@ func (m *MapKvTransaction) Put(key, val []byte) error {
 	return nil
 }
 func (m *MapKvTransaction) Get(key []byte) ([]byte, error) {
-	return m.mapkv.kv[string(key)], nil
+	val, ok := m.mapkv.kv[string(key)]
+	if !ok {
+		return nil, api.NotFound
+	}
+	return val, nil
 }
 func (m *MapKvTransaction) Delete(key []byte) error {
 	delete(m.mapkv.kv, string(key))
@@ -187,3 +206,61 @@ func TestTriePutDelete(t *testing.T) {
 		}
 	}
 }
+
+func TestTrieDeleteCollapse(t *testing.T) {
+	keys := []string{"", "a", "ab", "abc", "abd", "abde", "b", "ba", "bcdefgh", "bcdxyz", "c"}
+	for _, removed := range keys {
+		kv := &MapKv{
+			kv: map[string][]byte{},
+		}
+		testingTrie := New(crypto.SHA256.New, kv, []byte("test_root"))
+		txn, _ := testingTrie.Batch(nil)
+		for _, k := range keys {
+			if err := txn.Put([]byte(k), []byte(k+"_value")); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := txn.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := testingTrie.Delete([]byte(removed)); err != nil {
+			t.Fatal(err)
+		}
+
+		// the trie must look as if the removed key was never inserted
+		expectedKv := &MapKv{
+			kv: map[string][]byte{},
+		}
+		expectedTrie := New(crypto.SHA256.New, expectedKv, []byte("test_root"))
+		txn, _ = expectedTrie.Batch(nil)
+		for _, k := range keys {
+			if k != removed {
+				txn.Put([]byte(k), []byte(k+"_value"))
+			}
+		}
+		if err := txn.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		rootHash, _ := testingTrie.RootHash()
+		expectedHash, _ := expectedTrie.RootHash()
+		if !bytes.Equal(rootHash, expectedHash) {
+			t.Fatalf("root hash mismatch after deleting %q", removed)
+		}
+
+		for _, k := range keys {
+			val, err := testingTrie.Get([]byte(k))
+			if k == removed {
+				if err != KeyNotFound {
+					t.Fatalf("key %q not deleted", k)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(val, []byte(k+"_value")) {
+				t.Fatalf("key %q: value not equal", k)
+			}
+		}
+	}
+}